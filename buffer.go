@@ -0,0 +1,129 @@
+package slog
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// maxBufferedMessages is the maximum number of messages held in a
+// context buffer. Once full, the oldest messages are discarded.
+const maxBufferedMessages = 1000
+
+// messageBuffer holds messages that were logged with a context created by
+// WithBuffer: those below the minimum level, and while it holds any, those
+// that are enabled but below the trigger level.
+type messageBuffer struct {
+	minLevel Level
+	trigger  Level
+
+	mu      sync.Mutex // protects entries
+	entries []bufferedMessage
+}
+
+type bufferedMessage struct {
+	logger  *loggerImpl
+	msg     *Message
+	enabled bool // at or above the minimum level when it was logged
+}
+
+// WithBuffer returns a new context that holds back messages instead of
+// discarding them. Messages logged with the context that are below the
+// logger's minimum level, but at or above minLevel, are kept in memory.
+// If a message at the trigger level or above is logged with the context,
+// the buffered messages are output in the order they were logged, followed
+// by the message that triggered them.
+//
+// So that messages are output in the order they were logged, messages below
+// the trigger level that would otherwise be output are held back as well
+// while the buffer holds any messages. FlushBuffer outputs these messages
+// and discards the others, and should be called once the context is no
+// longer used.
+//
+// This makes it possible to log debug messages for a request only when the
+// request fails. At most 1000 messages are buffered; once the buffer is full
+// the oldest message is output if it would otherwise have been output, and
+// discarded if not.
+//
+//	ctx = slog.WithBuffer(ctx, slog.LevelDebug, slog.LevelError)
+//	defer slog.FlushBuffer(ctx)
+func WithBuffer(ctx context.Context, minLevel, trigger Level) context.Context {
+	return context.WithValue(ctx, keyBuffer, &messageBuffer{
+		minLevel: minLevel,
+		trigger:  trigger,
+	})
+}
+
+// bufferFromContext returns the message buffer associated
+// with the context, if any.
+func bufferFromContext(ctx context.Context) *messageBuffer {
+	if ctx == nil {
+		return nil
+	}
+	buf, _ := ctx.Value(keyBuffer).(*messageBuffer)
+	return buf
+}
+
+// FlushBuffer outputs the messages held back by the buffer of a context
+// created by WithBuffer that would have been output when they were logged,
+// and discards the messages below the minimum level. It does nothing if the
+// context has no buffer.
+func FlushBuffer(ctx context.Context) {
+	buf := bufferFromContext(ctx)
+	if buf == nil {
+		return
+	}
+	for _, e := range buf.take() {
+		if e.enabled {
+			e.logger.publish(e.msg)
+		}
+	}
+}
+
+// output outputs or holds back a message that was logged to l. Enabled
+// reports whether the message is at or above the minimum level.
+func (b *messageBuffer) output(l *loggerImpl, m *Message, enabled bool) {
+	b.mu.Lock()
+	switch {
+	case enabled && m.Level >= b.trigger:
+		// output the buffered messages before the message that triggered them
+		entries := b.entries
+		b.entries = nil
+		b.mu.Unlock()
+		for _, e := range entries {
+			e.logger.publish(e.msg)
+		}
+		l.publish(m)
+		return
+	case enabled && len(b.entries) == 0:
+		b.mu.Unlock()
+		l.publish(m)
+		return
+	case !enabled && m.Level < b.minLevel:
+		b.mu.Unlock()
+		return
+	}
+
+	var evicted *bufferedMessage
+	if len(b.entries) >= maxBufferedMessages {
+		if e := b.entries[0]; e.enabled {
+			evicted = &e
+		}
+		copy(b.entries, b.entries[1:])
+		b.entries = b.entries[:len(b.entries)-1]
+	}
+	b.entries = append(b.entries, bufferedMessage{logger: l, msg: m, enabled: enabled})
+	b.mu.Unlock()
+	if evicted != nil {
+		evicted.logger.publish(evicted.msg)
+	}
+}
+
+// take removes and returns all buffered messages.
+func (b *messageBuffer) take() []bufferedMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries := b.entries
+	b.entries = nil
+	return entries
+}
@@ -0,0 +1,123 @@
+package slog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// texts returns the texts of the messages received by the handler.
+func (th *testHandler) texts() []string {
+	var texts []string
+	for _, m := range th.Messages {
+		texts = append(texts, m.Text)
+	}
+	return texts
+}
+
+func TestWithBuffer(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	l.AddHandler(th)
+	ctx := WithBuffer(context.Background(), LevelDebug, LevelError)
+
+	// messages are output until a message is buffered, and are then
+	// held back too, so that they are output in the order they were logged
+	l.Info(ctx, "first info message")
+	l.Trace(ctx, "trace message")
+	l.Debug(ctx, "debug message")
+	l.Info(ctx, "info message")
+	l.Debug(ctx, "another debug message")
+	l.Warn(ctx, "warn message")
+	assert.Equal([]string{"first info message"}, th.texts())
+
+	th.Messages = nil
+	l.Error(ctx, "error message")
+	assert.Equal([]string{"debug message", "info message", "another debug message", "warn message", "error message"}, th.texts())
+
+	// buffer is empty after being output
+	th.Messages = nil
+	l.Error(ctx, "error message")
+	assert.Equal(1, len(th.Messages))
+
+	// messages logged without the buffer context are unaffected
+	th.Messages = nil
+	l.Debug(context.Background(), "debug message")
+	l.Error(context.Background(), "error message")
+	assert.Equal(1, len(th.Messages))
+}
+
+func TestFlushBuffer(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	l.AddHandler(th)
+	ctx := WithBuffer(context.Background(), LevelDebug, LevelError)
+
+	l.Debug(ctx, "debug message")
+	l.Info(ctx, "info message")
+	assert.Equal(0, len(th.Messages))
+	FlushBuffer(ctx)
+	assert.Equal([]string{"info message"}, th.texts())
+
+	// messages are output again once the buffer is empty
+	l.Info(ctx, "another info message")
+	assert.Equal([]string{"info message", "another info message"}, th.texts())
+	FlushBuffer(context.Background())
+}
+
+func TestWithBufferNamed(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	Default.SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	Default.AddHandler(th)
+	named := Named("test-buffer-named")
+	ctx := WithBuffer(context.Background(), LevelDebug, LevelError)
+
+	named.Debug(ctx, "named debug message")
+	Default.Debug(ctx, "debug message")
+	Default.Error(ctx, "error message")
+	if assert.Equal(3, len(th.Messages)) {
+		assert.Equal("test-buffer-named", th.Messages[0].Logger)
+		assert.Equal("", th.Messages[1].Logger)
+	}
+}
+
+func TestWithBufferLimit(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	l.AddHandler(th)
+	ctx := WithBuffer(context.Background(), LevelDebug, LevelError)
+
+	for i := 0; i < maxBufferedMessages+10; i++ {
+		l.Debug(ctx, fmt.Sprint(i))
+	}
+	l.Error(ctx, "error message")
+	assert.Equal(maxBufferedMessages+1, len(th.Messages))
+	assert.Equal("10", th.Messages[0].Text)
+	assert.Nil(bufferFromContext(nil))
+
+	// held back messages are output rather than discarded when the buffer is full
+	th.Messages = nil
+	l.Debug(ctx, "debug message")
+	l.Info(ctx, "info message")
+	for i := 0; i < maxBufferedMessages-2; i++ {
+		l.Debug(ctx, fmt.Sprint(i))
+	}
+	assert.Equal(0, len(th.Messages))
+	l.Debug(ctx, "evicts debug message")
+	assert.Equal(0, len(th.Messages))
+	l.Debug(ctx, "evicts info message")
+	assert.Equal([]string{"info message"}, th.texts())
+}
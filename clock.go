@@ -0,0 +1,76 @@
+package slog
+
+import "time"
+
+// Clock provides the current time for message timestamps. Loggers use the
+// system clock by default. Tests can use a fake clock so that timestamps
+// are predictable (see package slogtest).
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is an adapter that allows an ordinary function to be used as a Clock.
+type ClockFunc func() time.Time
+
+// Now calls f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// systemClock is the Clock used by loggers unless another clock is set
+// with SetClock. Replaced during testing.
+var systemClock Clock = ClockFunc(time.Now)
+
+// clockValue is stored in loggerImpl.clock, which as an atomic.Value
+// requires all stored values to have the same concrete type.
+type clockValue struct {
+	Clock
+}
+
+// SetClock sets the clock used for the timestamps of messages logged to
+// the logger. Setting a nil clock restores the system clock, except for a
+// named logger, which then uses the clock of the default logger.
+func (l *loggerImpl) SetClock(c Clock) {
+	l.clock.Store(clockValue{c})
+}
+
+// now returns the current time according to the logger's clock.
+func (l *loggerImpl) now() time.Time {
+	if v, _ := l.clock.Load().(clockValue); v.Clock != nil {
+		return v.Now()
+	}
+	if p := l.parent(); p != nil {
+		return p.now()
+	}
+	return systemClock.Now()
+}
+
+// Now returns the current time according to the clock of the default
+// logger. Use Now to record the start of an operation whose duration is
+// logged with WithElapsed, so that the duration is calculated using the
+// same clock as message timestamps.
+func Now() time.Time {
+	if l, ok := Default.(*loggerImpl); ok {
+		return l.now()
+	}
+	return systemClock.Now()
+}
+
+// WithElapsed sets a property named "elapsed" to the time elapsed between
+// start and the message timestamp.
+//
+// Times returned by the system clock include a monotonic clock reading, and
+// if both times have one the elapsed time is calculated using it, so that the
+// result is not affected by changes to the wall clock. Avoid passing times
+// that have been stripped of the monotonic reading, for example by calling
+// their UTC or Round methods.
+func WithElapsed(start time.Time) Option {
+	return WithElapsedKey("elapsed", start)
+}
+
+// WithElapsedKey is like WithElapsed, but sets the property with the given name.
+func WithElapsedKey(name string, start time.Time) Option {
+	return func(m *Message) {
+		m.Properties = append(m.Properties, Property{name, m.Timestamp.Sub(start)})
+	}
+}
@@ -0,0 +1,51 @@
+package slog
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetClock(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	Default.SetOutput(ioutil.Discard)
+	named := Named("test-set-clock")
+	defer named.SetClock(nil)
+
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	SetClock(ClockFunc(func() time.Time { return t1 }))
+	assert.Equal(t1, Info(context.Background(), "message").Timestamp)
+	assert.Equal(t1, named.Info(context.Background(), "message").Timestamp)
+	assert.Equal(t1, Now())
+
+	named.SetClock(ClockFunc(func() time.Time { return t2 }))
+	assert.Equal(t2, named.Info(context.Background(), "message").Timestamp)
+	assert.Equal(t1, Info(context.Background(), "message").Timestamp)
+
+	named.SetClock(nil)
+	SetClock(nil)
+	before := time.Now()
+	assert.False(named.Info(context.Background(), "message").Timestamp.Before(before))
+
+	// without a clock, loggers use the system clock
+	systemClock = ClockFunc(func() time.Time { return t2 })
+	defer func() { systemClock = ClockFunc(time.Now) }()
+	assert.Equal(t2, Info(context.Background(), "message").Timestamp)
+	assert.Equal(t2, named.Info(context.Background(), "message").Timestamp)
+	assert.Equal(t2, Now())
+}
+
+func TestWithElapsed(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Now()
+	m := &Message{Timestamp: start.Add(time.Second)}
+	m.applyOpts([]Option{WithElapsed(start), WithElapsedKey("duration", start)})
+	assert.Equal([]Property{{"elapsed", time.Second}, {"duration", time.Second}}, m.Properties)
+}
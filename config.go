@@ -0,0 +1,424 @@
+package slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	errUnknownOutputType  = errors.New("unknown output type")
+	errUnknownHandlerType = errors.New("unknown handler type")
+	errMissingType        = errors.New("missing type")
+	errMissingPath        = errors.New("missing path")
+	errUnexpectedPath     = errors.New("path only valid for file output")
+	errHandlerTypeExists  = errors.New("handler type already registered")
+	errNilHandlerFactory  = errors.New("nil handler factory")
+	errUnsupportedLogger  = errors.New("logger does not support configuration")
+	errInvalidLevelRange  = errors.New("max_level is less than level")
+)
+
+// Config describes a complete logging setup: the minimum level of the logger,
+// the outputs that messages are written to, the minimum levels of named loggers,
+// and the handlers that messages are sent to. A Config is usually read from a
+// JSON document using ParseConfig.
+//
+//	{
+//	  "level": "debug",
+//	  "outputs": [
+//	    {"type": "file", "path": "/var/log/app.log", "format": "logfmt"},
+//	    {"type": "stderr", "format": "json", "level": "warn"},
+//	    {"type": "stdout", "level": "debug", "max_level": "info"}
+//	  ],
+//	  "loggers": {"db": "debug", "http": "warn"},
+//	  "handlers": [
+//	    {"type": "audit", "level": "audit", "max_level": "audit", "params": {"url": "https://audit.example.com/"}}
+//	  ]
+//	}
+type Config struct {
+	Level    string            `json:"level,omitempty"`    // Minimum level of the logger, default "info"
+	Outputs  []OutputConfig    `json:"outputs,omitempty"`  // Outputs, default is stdout in logfmt format
+	Loggers  map[string]string `json:"loggers,omitempty"`  // Minimum levels of named loggers
+	Handlers []HandlerConfig   `json:"handlers,omitempty"` // Handlers created by registered factories
+}
+
+// OutputConfig describes an output in a Config.
+type OutputConfig struct {
+	Type     string `json:"type"`                // "stdout", "stderr" or "file"
+	Path     string `json:"path,omitempty"`      // File path, only for "file"
+	Format   string `json:"format,omitempty"`    // "logfmt" (default) or "json"
+	Level    string `json:"level,omitempty"`     // Minimum level written to the output
+	MaxLevel string `json:"max_level,omitempty"` // Maximum level written to the output
+}
+
+// HandlerConfig describes a handler in a Config. The handler is created by
+// the factory registered for the type using RegisterHandlerFactory.
+type HandlerConfig struct {
+	Type     string          `json:"type"`
+	Level    string          `json:"level,omitempty"`     // Minimum level sent to the handler
+	MaxLevel string          `json:"max_level,omitempty"` // Maximum level sent to the handler
+	Params   json.RawMessage `json:"params,omitempty"`    // Passed to the factory
+}
+
+// HandlerFactory creates a handler from the parameters in a configuration.
+type HandlerFactory func(params json.RawMessage) (Handler, error)
+
+// handlerFactories is the registry of handler factories.
+var handlerFactories = struct {
+	sync.RWMutex
+	m map[string]HandlerFactory
+}{
+	m: make(map[string]HandlerFactory),
+}
+
+// RegisterHandlerFactory registers a factory for creating handlers of the
+// given type from a configuration. It is usually called from the init
+// function of the package that implements the handler.
+func RegisterHandlerFactory(typ string, f HandlerFactory) error {
+	if f == nil {
+		return errNilHandlerFactory
+	}
+	handlerFactories.Lock()
+	defer handlerFactories.Unlock()
+	if _, ok := handlerFactories.m[typ]; ok {
+		return errHandlerTypeExists
+	}
+	handlerFactories.m[typ] = f
+	return nil
+}
+
+func lookupHandlerFactory(typ string) HandlerFactory {
+	handlerFactories.RLock()
+	defer handlerFactories.RUnlock()
+	return handlerFactories.m[typ]
+}
+
+// ConfigError describes an invalid value in a Config.
+type ConfigError struct {
+	Path string // Location of the value, eg "outputs[1].level"
+	Err  error  // The reason the value is invalid
+}
+
+func (e *ConfigError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// ConfigErrors is returned when a Config contains one or more invalid values.
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ParseConfig parses a JSON configuration document and validates it.
+// Unknown fields in the document are reported as errors.
+func ParseConfig(data []byte) (*Config, error) {
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate checks the configuration for invalid values. It does not open
+// any files or create any handlers. The returned error has type ConfigErrors.
+func (c *Config) Validate() error {
+	v := configValidator{}
+	v.level("level", c.Level)
+	for i, o := range c.Outputs {
+		path := fmt.Sprintf("outputs[%d]", i)
+		switch o.Type {
+		case "stdout", "stderr":
+			if o.Path != "" {
+				v.add(path+".path", errUnexpectedPath)
+			}
+		case "file":
+			if o.Path == "" {
+				v.add(path+".path", errMissingPath)
+			}
+		case "":
+			v.add(path+".type", errMissingType)
+		default:
+			v.add(path+".type", errUnknownOutputType)
+		}
+		if o.Format != "" {
+			if _, err := NewFormatter(o.Format); err != nil {
+				v.add(path+".format", err)
+			}
+		}
+		v.levelRange(path, o.Level, o.MaxLevel)
+	}
+	for _, name := range sortedKeys(c.Loggers) {
+		path := "loggers." + name
+		if name == "" {
+			v.add(path, errMissingLoggerName)
+		}
+		if c.Loggers[name] == "" {
+			v.add(path, errMissingLevel)
+		}
+		v.level(path, c.Loggers[name])
+	}
+	for i, h := range c.Handlers {
+		path := fmt.Sprintf("handlers[%d]", i)
+		if h.Type == "" {
+			v.add(path+".type", errMissingType)
+		} else if lookupHandlerFactory(h.Type) == nil {
+			v.add(path+".type", errUnknownHandlerType)
+		}
+		v.levelRange(path, h.Level, h.MaxLevel)
+	}
+	return v.err()
+}
+
+// ApplyConfig validates the configuration and applies it to the logger, which
+// must have been created by New. All outputs and handlers are created before
+// any change is made, and the logger's outputs and handlers are then swapped
+// in a single step, so messages are never lost or partially configured. Files
+// opened and handlers created by a previous configuration are closed, if the
+// handlers implement io.Closer. If an error occurs, the logger is unchanged.
+//
+// The configuration replaces all of the logger's outputs, including those set
+// with SetOutput, SetSinks and AddSink. Only the handlers created by a previous
+// configuration are replaced: handlers added in code, such as a DebugServer
+// or a handler added by a test, are kept, and receive messages before the
+// handlers created by the configuration. The handlers of the previous
+// configuration are closed after any calls to them in progress return, so
+// ApplyConfig must not be called from a handler of the logger.
+//
+// Named loggers listed in the configuration have their minimum level set.
+// Named loggers configured by a previous configuration but not listed in
+// this one revert to inheriting their minimum level.
+func ApplyConfig(l Logger, c *Config) error {
+	impl, ok := l.(*loggerImpl)
+	if !ok {
+		return errUnsupportedLogger
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	built, err := c.build()
+	if err != nil {
+		return err
+	}
+	closers, calls := impl.configure(built)
+	calls.Wait()
+	for _, closer := range closers {
+		closer.Close()
+	}
+	return nil
+}
+
+// ReloadConfig parses the JSON configuration document and applies it
+// to the logger. See ParseConfig and ApplyConfig.
+func ReloadConfig(l Logger, data []byte) error {
+	c, err := ParseConfig(data)
+	if err != nil {
+		return err
+	}
+	return ApplyConfig(l, c)
+}
+
+// builtConfig contains the outputs and handlers created from a Config.
+type builtConfig struct {
+	level    Level
+	sinks    []Sink
+	handlers handlerList
+	loggers  map[string]Level
+	closers  []io.Closer
+}
+
+// build creates the outputs and handlers described by a valid configuration.
+// If an error occurs, any files already opened are closed.
+func (c *Config) build() (b *builtConfig, err error) {
+	b = &builtConfig{
+		level:   LevelInfo,
+		loggers: make(map[string]Level),
+	}
+	defer func() {
+		if err != nil {
+			for _, closer := range b.closers {
+				closer.Close()
+			}
+		}
+	}()
+	v := configValidator{}
+	if c.Level != "" {
+		b.level.UnmarshalText([]byte(c.Level))
+	}
+
+	outputs := c.Outputs
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Type: "stdout"}}
+	}
+	for i, o := range outputs {
+		var sink Sink
+		switch o.Type {
+		case "stdout":
+			sink.Writer = os.Stdout
+		case "stderr":
+			sink.Writer = os.Stderr
+		case "file":
+			file, err := os.OpenFile(o.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				v.add(fmt.Sprintf("outputs[%d].path", i), err)
+				continue
+			}
+			b.closers = append(b.closers, file)
+			sink.Writer = file
+		}
+		if o.Format != "" {
+			sink.Formatter, _ = NewFormatter(o.Format)
+		}
+		sink.MinLevel, sink.MaxLevel = parseLevelRange(o.Level, o.MaxLevel)
+		b.sinks = append(b.sinks, sink)
+	}
+
+	for name, text := range c.Loggers {
+		var level Level
+		level.UnmarshalText([]byte(text))
+		b.loggers[name] = level
+	}
+
+	for i, hc := range c.Handlers {
+		h, err := lookupHandlerFactory(hc.Type)(hc.Params)
+		if err != nil {
+			v.add(fmt.Sprintf("handlers[%d].params", i), err)
+			continue
+		}
+		if closer, ok := h.(io.Closer); ok {
+			b.closers = append(b.closers, closer)
+		}
+		e := &handlerEntry{handler: h}
+		e.minLevel, e.maxLevel = parseLevelRange(hc.Level, hc.MaxLevel)
+		b.handlers = b.handlers.add(e)
+	}
+
+	if err := v.err(); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// configure replaces the logger's outputs, minimum level and the handlers of
+// the previous configuration with those of the configuration, and sets the
+// minimum levels of the named loggers. Returns the closers for the previous
+// configuration, and the calls to handlers that may still be using them.
+func (l *loggerImpl) configure(b *builtConfig) ([]io.Closer, *sync.WaitGroup) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	closers, calls := l.configClosers, l.calls
+	prevLoggers := l.configLoggers
+	l.out = nil
+	l.format = nil
+	l.sinks = b.sinks
+	handlers := l.handlers
+	for _, e := range l.configHandlers {
+		handlers = handlers.remove(e)
+	}
+	for _, e := range b.handlers {
+		handlers = handlers.add(e)
+	}
+	l.handlers = handlers
+	l.calls = new(sync.WaitGroup)
+	l.configHandlers = b.handlers
+	l.configClosers = b.closers
+	l.configLoggers = nil
+	for name := range b.loggers {
+		l.configLoggers = append(l.configLoggers, name)
+	}
+
+	// levels are replaced rather than set, as a LevelVar
+	// set with SetLevelVar may be shared with other loggers
+	l.level.Store(NewLevelVar(b.level))
+	for _, name := range prevLoggers {
+		if _, ok := b.loggers[name]; !ok {
+			setNamedLevel(name, nil)
+		}
+	}
+	for name, level := range b.loggers {
+		setNamedLevel(name, NewLevelVar(level))
+	}
+	return closers, calls
+}
+
+// setNamedLevel replaces the LevelVar of the named logger. It does not
+// lock the logger, which may be the logger being configured.
+func setNamedLevel(name string, v *LevelVar) {
+	if l, ok := Named(name).(*loggerImpl); ok && l.name != "" {
+		l.level.Store(v)
+	}
+}
+
+// configValidator accumulates configuration errors.
+type configValidator struct {
+	errs ConfigErrors
+}
+
+func (v *configValidator) add(path string, err error) {
+	v.errs = append(v.errs, &ConfigError{Path: path, Err: err})
+}
+
+func (v *configValidator) level(path, text string) {
+	if text == "" {
+		return
+	}
+	var level Level
+	if err := level.UnmarshalText([]byte(text)); err != nil {
+		v.add(path, err)
+	}
+}
+
+// levelRange checks the level and max_level fields at path.
+func (v *configValidator) levelRange(path, minText, maxText string) {
+	n := len(v.errs)
+	v.level(path+".level", minText)
+	v.level(path+".max_level", maxText)
+	if len(v.errs) == n {
+		if min, max := parseLevelRange(minText, maxText); max != 0 && max < min {
+			v.add(path+".max_level", errInvalidLevelRange)
+		}
+	}
+}
+
+func (v *configValidator) err() error {
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// parseLevelRange parses valid level and max_level fields. Empty
+// fields result in zero levels, meaning no minimum or maximum.
+func parseLevelRange(minText, maxText string) (min, max Level) {
+	if minText != "" {
+		min.UnmarshalText([]byte(minText))
+	}
+	if maxText != "" {
+		max.UnmarshalText([]byte(maxText))
+	}
+	return min, max
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,258 @@
+package slog
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+)
+
+func init() {
+	RegisterHandlerFactory("test-config", func(params json.RawMessage) (Handler, error) {
+		var p struct{ Fail bool }
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if p.Fail {
+			return nil, errors.New("factory failed")
+		}
+		return &testHandler{}, nil
+	})
+	RegisterHandlerFactory("test-blocking", func(json.RawMessage) (Handler, error) {
+		return &blockingHandler{
+			entered: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}, nil
+	})
+}
+
+// blockingHandler blocks in Handle until it is released.
+type blockingHandler struct {
+	entered chan struct{}
+	release chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (h *blockingHandler) Handle([]*Message) {
+	h.entered <- struct{}{}
+	<-h.release
+}
+
+func (h *blockingHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	return nil
+}
+
+func (h *blockingHandler) isClosed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+func TestRegisterHandlerFactory(t *testing.T) {
+	assert := assert.New(t)
+	assert.Error(RegisterHandlerFactory("test-config", func(json.RawMessage) (Handler, error) { return nil, nil }))
+	assert.Error(RegisterHandlerFactory("test-nil", nil))
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := ParseConfig([]byte(`{"level": "info", "unknown": 1}`))
+	assert.Error(err)
+	_, err = ParseConfig([]byte(`{"level": `))
+	assert.Error(err)
+
+	_, err = ParseConfig([]byte(`{
+		"level": "loud",
+		"outputs": [
+			{"type": "stdout", "path": "/tmp/x"},
+			{"type": "file", "format": "xml", "level": "high"},
+			{"type": "stderr", "level": "error", "max_level": "warn"},
+			{"type": "socket"},
+			{}
+		],
+		"loggers": {"db": "xxx", "http": ""},
+		"handlers": [{"type": "test-missing"}, {"max_level": "xxx"}]
+	}`))
+	errs, ok := err.(ConfigErrors)
+	assert.True(ok)
+	var paths []string
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal([]string{
+		"level",
+		"outputs[0].path",
+		"outputs[1].path",
+		"outputs[1].format",
+		"outputs[1].level",
+		"outputs[2].max_level",
+		"outputs[3].type",
+		"outputs[4].type",
+		"loggers.db",
+		"loggers.http",
+		"handlers[0].type",
+		"handlers[1].type",
+		"handlers[1].max_level",
+	}, paths)
+	assert.True(strings.HasPrefix(err.Error(), "level: invalid level; outputs[0].path: "))
+}
+
+func TestApplyConfig(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "slog")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	debugFile := filepath.Join(dir, "debug.log")
+	warnFile := filepath.Join(dir, "warn.log")
+
+	l := New()
+	c, err := ParseConfig([]byte(`{
+		"level": "debug",
+		"outputs": [
+			{"type": "file", "path": "` + debugFile + `"},
+			{"type": "file", "path": "` + warnFile + `", "format": "json", "level": "warn"}
+		],
+		"loggers": {"test-config-db": "error"},
+		"handlers": [{"type": "test-config", "max_level": "info", "params": {}}]
+	}`))
+	assert.NoError(err)
+	assert.NoError(ApplyConfig(l, c))
+	assert.Equal(LevelDebug, l.LevelVar().Level())
+	assert.Equal(LevelError, Named("test-config-db").LevelVar().Level())
+	impl := l.(*loggerImpl)
+	assert.Nil(impl.out)
+	assert.Equal(1, len(impl.handlers))
+	th := impl.handlers[0].handler.(*testHandler)
+
+	ctx := context.Background()
+	l.Debug(ctx, "debug message")
+	l.Warn(ctx, "warn message")
+	assert.Equal(1, len(th.Messages))
+
+	b, err := ioutil.ReadFile(debugFile)
+	assert.NoError(err)
+	assert.Contains(string(b), `debug msg="debug message"`)
+	assert.Contains(string(b), `warn msg="warn message"`)
+	b, err = ioutil.ReadFile(warnFile)
+	assert.NoError(err)
+	assert.NotContains(string(b), `debug message`)
+	assert.Contains(string(b), `"level":"warn","msg":"warn message"`)
+
+	// failed reload leaves the logger unchanged
+	err = ReloadConfig(l, []byte(`{"handlers": [{"type": "test-config", "params": {"fail": true}}]}`))
+	assert.Error(err)
+	assert.Equal("handlers[0].params: factory failed", err.Error())
+	assert.Exactly(th, impl.handlers[0].handler)
+
+	// reload swaps configuration and closes files
+	assert.NoError(ReloadConfig(l, []byte(`{"outputs": [{"type": "stderr"}]}`)))
+	assert.Equal(LevelInfo, l.LevelVar().Level())
+	assert.True(Named("test-config-db").(*loggerImpl).inheritsLevel())
+	assert.Equal(0, len(impl.handlers))
+	assert.Equal([]Sink{{Writer: os.Stderr}}, impl.sinks)
+	assert.Equal(0, len(impl.configClosers))
+}
+
+func TestApplyConfigDefaults(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	assert.NoError(ReloadConfig(l, []byte(`{}`)))
+	assert.Equal([]Sink{{Writer: os.Stdout}}, l.(*loggerImpl).sinks)
+}
+
+func TestApplyConfigKeepsHandlers(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(ioutil.Discard)
+	added := &testHandler{}
+	reg := l.AddHandler(added)
+	impl := l.(*loggerImpl)
+
+	config := []byte(`{"outputs": [{"type": "stderr", "level": "fatal"}], "handlers": [{"type": "test-config", "params": {}}]}`)
+	assert.NoError(ReloadConfig(l, config))
+	assert.Equal(2, len(impl.handlers))
+	assert.Exactly(added, impl.handlers[0].handler)
+	first := impl.handlers[1].handler.(*testHandler)
+
+	// reloading replaces only the handler created by the configuration
+	assert.NoError(ReloadConfig(l, config))
+	assert.Equal(2, len(impl.handlers))
+	assert.Exactly(added, impl.handlers[0].handler)
+	second := impl.handlers[1].handler.(*testHandler)
+	assert.False(first == second)
+
+	ctx := context.Background()
+	l.Info(ctx, "message")
+	assert.Equal(1, len(added.Messages))
+	assert.Equal(0, len(first.Messages))
+	assert.Equal(1, len(second.Messages))
+
+	// the added handler can still be removed, and a configuration
+	// without handlers removes the configured handler
+	reg.Remove()
+	assert.NoError(ReloadConfig(l, []byte(`{"outputs": [{"type": "stderr", "level": "fatal"}]}`)))
+	assert.Equal(0, len(impl.handlers))
+}
+
+func TestApplyConfigSharedLevelVar(t *testing.T) {
+	assert := assert.New(t)
+	shared := NewLevelVar(LevelWarning)
+	l := New()
+	l.SetLevelVar(shared)
+	Named("test-config-shared").SetLevelVar(shared)
+
+	assert.NoError(ReloadConfig(l, []byte(`{
+		"level": "debug",
+		"outputs": [{"type": "stderr", "level": "fatal"}],
+		"loggers": {"test-config-shared": "error"}
+	}`)))
+	assert.Equal(LevelWarning, shared.Level())
+	assert.Equal(LevelDebug, l.LevelVar().Level())
+	assert.Equal(LevelError, Named("test-config-shared").LevelVar().Level())
+}
+
+func TestApplyConfigWaitsForHandlers(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	config := []byte(`{"outputs": [{"type": "stderr", "level": "fatal"}], "handlers": [{"type": "test-blocking"}]}`)
+	assert.NoError(ReloadConfig(l, config))
+	h := l.(*loggerImpl).handlers[0].handler.(*blockingHandler)
+
+	go l.Info(context.Background(), "message")
+	<-h.entered
+	applied := make(chan error)
+	go func() {
+		applied <- ReloadConfig(l, []byte(`{"outputs": [{"type": "stderr", "level": "fatal"}]}`))
+	}()
+
+	// the replaced handler is not closed while it is handling a message
+	select {
+	case <-applied:
+		t.Fatal("configuration applied while the handler was in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.False(h.isClosed())
+
+	close(h.release)
+	select {
+	case err := <-applied:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("configuration not applied after the handler returned")
+	}
+	assert.True(h.isClosed())
+}
@@ -14,6 +14,8 @@ type contextKey int
 
 const (
 	keyLogData contextKey = iota
+	keyMinLevel
+	keyBuffer
 )
 
 // NewContext returns a new context that has one or more properties associated with it
@@ -51,3 +53,21 @@ func fromContext(ctx context.Context) *logData {
 	}
 	return data
 }
+
+// WithMinLevel returns a new context that overrides the minimum log level for
+// messages logged with the context and any context derived from it. This
+// makes it possible to enable debug logging for a single request without
+// changing the minimum level for all other requests.
+func WithMinLevel(ctx context.Context, level Level) context.Context {
+	return context.WithValue(ctx, keyMinLevel, level)
+}
+
+// minLevelFromContext returns the minimum level override associated
+// with the context, if any.
+func minLevelFromContext(ctx context.Context) (Level, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	level, ok := ctx.Value(keyMinLevel).(Level)
+	return level, ok
+}
@@ -44,3 +44,18 @@ func TestFromContext(t *testing.T) {
 	assert := assert.New(t)
 	assert.Nil(fromContext(context.Background()))
 }
+
+func TestWithMinLevel(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	_, ok := minLevelFromContext(ctx)
+	assert.False(ok)
+	_, ok = minLevelFromContext(nil)
+	assert.False(ok)
+
+	ctx = WithMinLevel(ctx, LevelDebug)
+	ctx = NewContext(ctx, Property{"a", "b"})
+	level, ok := minLevelFromContext(ctx)
+	assert.True(ok)
+	assert.Equal(LevelDebug, level)
+}
@@ -0,0 +1,328 @@
+package slog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultDebugMessages is the size of the ring buffer
+	// created by NewDebugServer if none is supplied.
+	defaultDebugMessages = 1000
+
+	// debugClientBuffer is the number of messages buffered for
+	// each streaming client before messages are dropped.
+	debugClientBuffer = 256
+)
+
+var (
+	errInvalidTime  = errors.New("invalid time")
+	errInvalidLimit = errors.New("invalid limit")
+)
+
+// DebugServer serves recent and live log messages over HTTP, so that the
+// log of a single process can be viewed from a browser. A DebugServer is a
+// Handler, and must be added to a Logger to receive messages.
+//
+//	ds := slog.NewDebugServer(nil)
+//	slog.AddHandler(ds)
+//	http.Handle("/debug/slog", ds)
+//
+// A GET request returns the recent messages in HTML, logfmt or JSON format,
+// depending on the "format" query parameter. The messages can be filtered with
+// the query parameters "level", "max_level", "since", "until" (RFC3339 times,
+// or durations such as "5m" meaning five minutes ago), "key" and "value",
+// "code", "text", and "limit".
+//
+// If the request accepts "text/event-stream", or has a "follow" query parameter,
+// live messages that match the filters are streamed using Server-Sent Events.
+// Each event contains one message in JSON format, or in logfmt format if the
+// "format" parameter is "logfmt". Messages are dropped for clients that do not
+// keep up, so a slow client never blocks the program that is logging.
+type DebugServer struct {
+	buffer *RingBuffer
+
+	mu      sync.Mutex                // protects the following fields
+	clients map[*debugClient]struct{} // streaming clients
+}
+
+// debugClient is a client receiving messages with Server-Sent Events.
+type debugClient struct {
+	query   Query
+	ch      chan *Message
+	mu      sync.Mutex // protects dropped
+	dropped int
+}
+
+// NewDebugServer returns a DebugServer that keeps recent messages in buffer.
+// If buffer is nil, a ring buffer of the most recent 1000 messages is created.
+func NewDebugServer(buffer *RingBuffer) *DebugServer {
+	if buffer == nil {
+		buffer = NewRingBuffer(defaultDebugMessages, 0)
+	}
+	return &DebugServer{
+		buffer:  buffer,
+		clients: make(map[*debugClient]struct{}),
+	}
+}
+
+// Buffer returns the ring buffer of recent messages.
+func (s *DebugServer) Buffer() *RingBuffer {
+	return s.buffer
+}
+
+// Handle implements the Handler interface. Messages are added to the ring
+// buffer and sent to streaming clients. Handle never blocks waiting for a
+// client: if a client's buffer is full, the message is dropped for that client.
+func (s *DebugServer) Handle(msgs []*Message) {
+	s.buffer.Handle(msgs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		for _, m := range msgs {
+			if !c.query.Match(m) {
+				continue
+			}
+			select {
+			case c.ch <- m:
+			default:
+				c.mu.Lock()
+				c.dropped++
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (s *DebugServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseDebugQuery(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+
+	if _, ok := r.URL.Query()["follow"]; ok || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.stream(w, r, q, format)
+		return
+	}
+
+	msgs := s.buffer.Query(q)
+	switch format {
+	case "logfmt":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, m := range msgs {
+			LogfmtFormatter{}.Format(w, m)
+		}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, m := range msgs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			JSONFormatter{}.write(&buf, m)
+		}
+		buf.WriteString("]\n")
+		buf.WriteTo(w)
+	case "", "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		debugTemplate.Execute(w, debugPage{
+			Messages: msgs,
+			Query:    r.URL.Query(),
+		})
+	default:
+		http.Error(w, errUnknownFormat.Error(), http.StatusBadRequest)
+	}
+}
+
+// stream sends live messages to the client using Server-Sent Events
+// until the client disconnects.
+func (s *DebugServer) stream(w http.ResponseWriter, r *http.Request, q Query, format string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	var formatter Formatter = JSONFormatter{}
+	if format == "logfmt" {
+		formatter = LogfmtFormatter{}
+	}
+
+	c := &debugClient{
+		query: q,
+		ch:    make(chan *Message, debugClientBuffer),
+	}
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var buf bytes.Buffer
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case m := <-c.ch:
+			buf.Reset()
+			c.mu.Lock()
+			dropped := c.dropped
+			c.dropped = 0
+			c.mu.Unlock()
+			if dropped > 0 {
+				fmt.Fprintf(&buf, "event: dropped\ndata: %d\n\n", dropped)
+			}
+			buf.WriteString("data: ")
+			formatter.Format(&buf, m)
+			buf.WriteByte('\n')
+			if _, err := buf.WriteTo(w); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// parseDebugQuery builds a Query from the request query parameters.
+func parseDebugQuery(r *http.Request, now time.Time) (Query, error) {
+	values := r.URL.Query()
+	q := Query{
+		Key:   values.Get("key"),
+		Value: values.Get("value"),
+		Code:  values.Get("code"),
+		Text:  values.Get("text"),
+	}
+	if v := values.Get("level"); v != "" {
+		if err := q.MinLevel.UnmarshalText([]byte(v)); err != nil {
+			return q, err
+		}
+	}
+	if v := values.Get("max_level"); v != "" {
+		if err := q.MaxLevel.UnmarshalText([]byte(v)); err != nil {
+			return q, err
+		}
+	}
+	var err error
+	if q.Since, err = parseDebugTime(values.Get("since"), now); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseDebugTime(values.Get("until"), now); err != nil {
+		return q, err
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 0 {
+			return q, errInvalidLimit
+		}
+	}
+	return q, nil
+}
+
+// parseDebugTime parses an RFC3339 time, or a duration
+// relative to now. An empty string is the zero time.
+func parseDebugTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			d = -d
+		}
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return t, errInvalidTime
+	}
+	return t, nil
+}
+
+type debugPage struct {
+	Messages []*Message
+	Query    map[string][]string
+}
+
+var debugTemplate = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"timestamp": func(t time.Time) string { return t.Format("2006-01-02 15:04:05.000") },
+	"param": func(q map[string][]string, key string) string {
+		if v := q[key]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>slog</title>
+<style>
+body { font-family: monospace; font-size: 13px; }
+table { border-collapse: collapse; }
+td { padding: 1px 8px; vertical-align: top; white-space: pre-wrap; }
+.trace, .debug { color: gray; }
+.warn { color: darkorange; }
+.error, .fatal { color: red; }
+</style>
+</head>
+<body>
+<form method="GET">
+level <input name="level" size="6" value="{{param .Query "level"}}">
+since <input name="since" size="20" value="{{param .Query "since"}}">
+key <input name="key" size="10" value="{{param .Query "key"}}">
+value <input name="value" size="10" value="{{param .Query "value"}}">
+code <input name="code" size="10" value="{{param .Query "code"}}">
+<input type="submit" value="Filter">
+<label><input type="checkbox" id="follow"> Follow</label>
+</form>
+<table id="messages">
+{{range .Messages}}<tr class="{{.Level}}"><td>{{timestamp .Timestamp}}</td><td>{{.Level}}</td><td>{{.Text}}</td><td>{{.Logfmt}}</td></tr>
+{{end}}</table>
+<script>
+var source;
+document.getElementById("follow").onchange = function(e) {
+	if (source) { source.close(); source = null; }
+	if (!e.target.checked) { return; }
+	var params = new URLSearchParams(window.location.search);
+	params.set("follow", "1");
+	params.delete("since");
+	params.delete("until");
+	params.delete("limit");
+	source = new EventSource("?" + params.toString());
+	source.onmessage = function(e) {
+		var m = JSON.parse(e.data);
+		var tr = document.createElement("tr");
+		tr.className = m.level;
+		[m.time, m.level, m.msg, e.data].forEach(function(text) {
+			var td = document.createElement("td");
+			td.textContent = text;
+			tr.appendChild(td);
+		});
+		document.getElementById("messages").appendChild(tr);
+		window.scrollTo(0, document.body.scrollHeight);
+	};
+};
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,125 @@
+package slog
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugServerGet(t *testing.T) {
+	assert := assert.New(t)
+	ds := NewDebugServer(nil)
+	now := time.Now()
+	ds.Handle([]*Message{
+		{Timestamp: now.Add(-time.Hour), Level: LevelInfo, Text: "old"},
+		{Timestamp: now, Level: LevelDebug, Text: "debug", Properties: []Property{{"user", "alice"}}},
+		{Timestamp: now, Level: LevelError, Text: "<error>"},
+	})
+
+	w := httptest.NewRecorder()
+	ds.ServeHTTP(w, httptest.NewRequest("GET", "/debug/slog?format=logfmt&level=info", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if assert.Len(lines, 2) {
+		assert.Contains(lines[0], "msg=old")
+		assert.Contains(lines[1], "msg=<error>")
+	}
+
+	w = httptest.NewRecorder()
+	ds.ServeHTTP(w, httptest.NewRequest("GET", "/debug/slog?format=json&since=10m", nil))
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+	var msgs []map[string]interface{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &msgs))
+	if assert.Len(msgs, 2) {
+		assert.Equal("debug", msgs[0]["msg"])
+		assert.Equal("<error>", msgs[1]["msg"])
+	}
+
+	w = httptest.NewRecorder()
+	ds.ServeHTTP(w, httptest.NewRequest("GET", "/debug/slog?format=json&key=user&value=alice", nil))
+	msgs = nil
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &msgs))
+	assert.Len(msgs, 1)
+
+	w = httptest.NewRecorder()
+	ds.ServeHTTP(w, httptest.NewRequest("GET", "/debug/slog", nil))
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(w.Body.String(), "&lt;error&gt;")
+	assert.NotContains(w.Body.String(), "<error>")
+
+	for _, query := range []string{"level=loud", "since=yesterday", "limit=-1", "format=xml"} {
+		w = httptest.NewRecorder()
+		ds.ServeHTTP(w, httptest.NewRequest("GET", "/debug/slog?"+query, nil))
+		assert.Equal(http.StatusBadRequest, w.Code, query)
+	}
+
+	w = httptest.NewRecorder()
+	ds.ServeHTTP(w, httptest.NewRequest("POST", "/debug/slog", nil))
+	assert.Equal(http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestDebugServerStream(t *testing.T) {
+	assert := assert.New(t)
+	ds := NewDebugServer(nil)
+	server := httptest.NewServer(ds)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?follow&level=warn")
+	if !assert.NoError(err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	// wait for the client to be registered
+	for i := 0; i < 100 && ds.clientCount() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(1, ds.clientCount())
+
+	ds.Handle([]*Message{
+		{Timestamp: time.Now(), Level: LevelInfo, Text: "ignored"},
+		{Timestamp: time.Now(), Level: LevelWarning, Text: "warning"},
+	})
+
+	r := bufio.NewReader(resp.Body)
+	line, err := r.ReadString('\n')
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(line, "data: {"))
+	assert.Contains(line, `"msg":"warning"`)
+}
+
+func TestDebugServerSlowClient(t *testing.T) {
+	assert := assert.New(t)
+	ds := NewDebugServer(nil)
+	c := &debugClient{ch: make(chan *Message, 2)}
+	ds.clients[c] = struct{}{}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			ds.Handle([]*Message{{Level: LevelInfo, Text: "message"}})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Handle blocked on slow client")
+	}
+	assert.Len(c.ch, 2)
+	assert.Equal(3, c.dropped)
+	assert.Equal(5, ds.Buffer().Len())
+}
+
+func (s *DebugServer) clientCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
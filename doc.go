@@ -18,8 +18,9 @@
 //  // 2009-11-10T12:34:56.789 error msg="cannot open file" filename=/etc/hosts error="file does not exist" userip=123.231.111.222
 //
 // Out of the box, this package logs to stdout in logfmt format. (https://brandur.org/logfmt).
-// Other formats are planned (including pretty TTY output), and a handler mechanism exists to
-// integrate with external logging providers.
+// JSON output is available using SetFormatter, and a handler mechanism exists to
+// integrate with external logging providers. The default logger can be configured
+// from environment variables using ConfigureFromEnv.
 //
 // See the examples for more details. A more comprehensive guide is
 // available at https://github.com/spkg/slog
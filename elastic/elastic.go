@@ -0,0 +1,448 @@
+// Package elastic provides a slog handler that sends messages to
+// Elasticsearch or OpenSearch using the bulk API, as documents with
+// field names from the Elastic Common Schema (ECS).
+//
+//	h, err := elastic.New(elastic.Config{
+//		URL:      "https://search.example.com:9200",
+//		Index:    "myapp",
+//		Username: "logger",
+//		Password: password,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer h.Close()
+//	slog.AddHandler(h)
+//
+// Messages are written to a daily index named after the date of their
+// timestamp in UTC, such as "myapp-2020.01.02". Each document has the
+// following fields, where present:
+//
+//	@timestamp                 message timestamp
+//	message                    message text
+//	log.level                  level name
+//	log.logger                 logger name
+//	error.message              error text
+//	event.code                 message code
+//	http.response.status_code  message status
+//	host.name                  host name
+//	service.name               service name from the configuration
+//	labels                     properties and context values, as strings
+//
+// The package registers the "elastic" handler type for use in a slog.Config,
+// with a Config in JSON format as its parameters. Durations in the
+// parameters are strings such as "5s".
+package elastic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/batch"
+	"github.com/spkg/slog/internal/handlerfmt"
+	"github.com/spkg/slog/internal/jsonconfig"
+)
+
+// Defaults for the configuration.
+const (
+	DefaultIndex         = "slog"
+	DefaultIndexDate     = "2006.01.02"
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = batch.DefaultFlushInterval
+	DefaultQueueSize     = batch.DefaultQueueSize
+	DefaultConcurrency   = 2
+	DefaultMaxRetries    = 3
+	DefaultMinBackoff    = batch.DefaultMinBackoff
+	DefaultMaxBackoff    = batch.DefaultMaxBackoff
+	DefaultFlushTimeout  = batch.DefaultFlushTimeout
+	DefaultTimeout       = 30 * time.Second
+)
+
+// ecsVersion is the version of the Elastic Common Schema
+// that documents conform to.
+const ecsVersion = "1.12.0"
+
+var (
+	errNoURL       = errors.New("elastic: no URL")
+	errBadResponse = errors.New("elastic: invalid bulk response")
+)
+
+// Config describes the cluster, the documents written to it,
+// and how batches are sent.
+type Config struct {
+	URL           string            `json:"url"`                      // Base URL of the cluster
+	Index         string            `json:"index,omitempty"`          // Index name prefix, default "slog"
+	IndexDate     string            `json:"index_date,omitempty"`     // Layout of the index date, default "2006.01.02"
+	Service       string            `json:"service,omitempty"`        // service.name field, omitted if empty
+	Host          string            `json:"host,omitempty"`           // host.name field, default is the system host name
+	Username      string            `json:"username,omitempty"`       // Basic authentication user
+	Password      string            `json:"password,omitempty"`       // Basic authentication password
+	APIKey        string            `json:"api_key,omitempty"`        // Encoded API key, instead of basic authentication
+	Headers       map[string]string `json:"headers,omitempty"`        // Added to each request
+	BatchSize     int               `json:"batch_size,omitempty"`     // Maximum documents per request
+	FlushInterval time.Duration     `json:"flush_interval,omitempty"` // Maximum time a message waits before it is sent
+	QueueSize     int               `json:"queue_size,omitempty"`     // Maximum messages waiting to be sent
+	Concurrency   int               `json:"concurrency,omitempty"`    // Maximum concurrent bulk requests
+	MaxRetries    int               `json:"max_retries,omitempty"`    // Retries of failed documents; negative for none
+	MinBackoff    time.Duration     `json:"min_backoff,omitempty"`    // Delay before the first retry
+	MaxBackoff    time.Duration     `json:"max_backoff,omitempty"`    // Maximum delay between retries
+	FlushTimeout  time.Duration     `json:"flush_timeout,omitempty"`  // Maximum time Flush and Close wait for batches to be sent
+	Timeout       time.Duration     `json:"timeout,omitempty"`        // Timeout of each request
+
+	// Client sends the requests. If nil, a client with
+	// the configured timeout is used.
+	Client *http.Client `json:"-"`
+
+	// OnError, if not nil, is called with the error when documents
+	// are discarded because they could not be written. It is called from
+	// a separate goroutine, and may log the error to a logger that uses
+	// the handler, but must not close the handler.
+	OnError func(error) `json:"-"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface,
+// parsing durations with time.ParseDuration.
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type config Config
+	return jsonconfig.Unmarshal(b, (*config)(c), "flush_interval", "min_backoff", "max_backoff", "flush_timeout", "timeout")
+}
+
+// StatusError is the error for a bulk request that failed
+// with an unsuccessful HTTP status.
+type StatusError = batch.StatusError
+
+// ItemError is the error for a document that was rejected
+// by the bulk API.
+type ItemError struct {
+	Index  string
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("elastic: %s: %s: %s", e.Index, e.Type, e.Reason)
+}
+
+// Temporary reports whether the document may be written if it is retried,
+// which is the case for 5xx and 429 statuses.
+func (e *ItemError) Temporary() bool {
+	return batch.TemporaryStatus(e.Status)
+}
+
+// Handler is a slog.Handler that queues messages and writes them
+// in batches with the bulk API.
+//
+// A batch is sent when it reaches the batch size, or when the flush interval
+// has passed. Up to the configured number of batches are sent concurrently.
+// If the bulk request fails because of a network error or a 5xx or 429
+// status, it is retried with exponential backoff and jitter. If the request
+// succeeds but some documents are rejected with a 5xx or 429 status, only
+// those documents are retried. Documents that cannot be written are
+// discarded.
+//
+// When the queue is full, the oldest message is dropped.
+// A Handler is safe for concurrent use.
+type Handler struct {
+	config Config
+	queue  *batch.Queue
+}
+
+func init() {
+	slog.RegisterHandlerFactory("elastic", func(params json.RawMessage) (slog.Handler, error) {
+		var c Config
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &c); err != nil {
+				return nil, err
+			}
+		}
+		return New(c)
+	})
+}
+
+// New returns a handler that writes messages to the cluster described by
+// the configuration. It starts a goroutine that sends the batches, which
+// stops when the handler is closed.
+func New(c Config) (*Handler, error) {
+	if c.URL == "" {
+		return nil, errNoURL
+	}
+	c.URL = strings.TrimSuffix(c.URL, "/")
+	if c.Index == "" {
+		c.Index = DefaultIndex
+	}
+	if c.IndexDate == "" {
+		c.IndexDate = DefaultIndexDate
+	}
+	if c.Host == "" {
+		c.Host, _ = os.Hostname()
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = DefaultMaxRetries
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: c.Timeout}
+	}
+	h := &Handler{config: c}
+	h.queue = batch.New(batch.Options{
+		Name:          "elastic",
+		BatchSize:     c.BatchSize,
+		FlushInterval: c.FlushInterval,
+		QueueSize:     c.QueueSize,
+		Concurrency:   c.Concurrency,
+		MaxRetries:    c.MaxRetries,
+		MinBackoff:    c.MinBackoff,
+		MaxBackoff:    c.MaxBackoff,
+		FlushTimeout:  c.FlushTimeout,
+		Send:          h.send,
+		OnError:       c.OnError,
+	})
+	return h, nil
+}
+
+// Handle implements the slog.Handler interface.
+func (h *Handler) Handle(msgs []*slog.Message) {
+	h.queue.Handle(msgs)
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (h *Handler) Dropped() int64 {
+	return h.queue.Dropped()
+}
+
+// Flush implements the slog.Flusher interface. It sends all queued messages,
+// waits for all batches to be written, and returns the last error for
+// documents that could not be written since the previous flush, if any.
+// If the batches have not been written within the flush timeout, Flush
+// returns an error while they continue to be written.
+func (h *Handler) Flush() error {
+	return h.queue.Flush()
+}
+
+// Close writes all queued messages and stops the handler. Messages
+// handled after Close are discarded. If the messages have not been written
+// within the flush timeout, failed requests are not retried, and the
+// messages still queued are discarded.
+func (h *Handler) Close() error {
+	return h.queue.Close()
+}
+
+// send writes a batch, retrying the documents that failed with an error
+// that may be temporary. Returns the error for the last document that
+// could not be written.
+func (h *Handler) send(msgs []*slog.Message) error {
+	var lastErr error
+	failed := func(err error) {
+		lastErr = err
+		h.queue.Discard(err)
+	}
+	items := make([][]byte, 0, len(msgs))
+	for _, m := range msgs {
+		b, err := h.encode(m)
+		if err != nil {
+			failed(err)
+			continue
+		}
+		items = append(items, b)
+	}
+	for attempt := 0; len(items) > 0; attempt++ {
+		errs, wait, err := h.bulk(items)
+		if err != nil {
+			if wait < 0 || attempt >= h.config.MaxRetries {
+				failed(err)
+				break
+			}
+		} else {
+			var retry [][]byte
+			for i, ierr := range errs {
+				if ierr == nil {
+					continue
+				}
+				if !ierr.Temporary() || attempt >= h.config.MaxRetries {
+					failed(ierr)
+					continue
+				}
+				err = ierr
+				retry = append(retry, items[i])
+			}
+			if items = retry; len(items) == 0 {
+				break
+			}
+		}
+		if !h.queue.Wait(attempt, wait) {
+			// the handler is closing, so the documents are not retried
+			failed(err)
+			break
+		}
+	}
+	return lastErr
+}
+
+// bulkResponse is the part of the bulk API response that describes
+// the result for each document.
+type bulkResponse struct {
+	Errors bool                  `json:"errors"`
+	Items  []map[string]bulkItem `json:"items"`
+}
+
+type bulkItem struct {
+	Index  string `json:"_index"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// bulk sends a bulk request with the encoded items. If the request succeeds,
+// it returns the error for each item, which is nil for items that were
+// written. If the request fails and can be retried, it returns the delay
+// requested by the server, which is zero if none was given. If the request
+// cannot be retried, the delay is negative.
+func (h *Handler) bulk(items [][]byte) ([]*ItemError, time.Duration, error) {
+	req, err := http.NewRequest("POST", h.config.URL+"/_bulk", bytes.NewReader(bytes.Join(items, nil)))
+	if err != nil {
+		return nil, -1, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if h.config.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+h.config.APIKey)
+	} else if h.config.Username != "" {
+		req.SetBasicAuth(h.config.Username, h.config.Password)
+	}
+	for k, v := range h.config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.config.Client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if wait, err := h.queue.CheckStatus(resp); err != nil {
+		return nil, wait, err
+	}
+
+	var br bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&br); err != nil {
+		return nil, -1, errBadResponse
+	}
+	errs := make([]*ItemError, len(items))
+	if !br.Errors {
+		return errs, 0, nil
+	}
+	if len(br.Items) != len(items) {
+		return nil, -1, errBadResponse
+	}
+	for i, result := range br.Items {
+		for _, item := range result {
+			if item.Status >= 200 && item.Status < 300 {
+				continue
+			}
+			ierr := &ItemError{Index: item.Index, Status: item.Status}
+			if item.Error != nil {
+				ierr.Type = item.Error.Type
+				ierr.Reason = item.Error.Reason
+			}
+			errs[i] = ierr
+		}
+	}
+	return errs, 0, nil
+}
+
+// IndexName returns the name of the index for a message timestamp.
+func (h *Handler) IndexName(t time.Time) string {
+	return h.config.Index + "-" + t.UTC().Format(h.config.IndexDate)
+}
+
+// encode returns the bulk action and document for a message,
+// each terminated by a new line.
+func (h *Handler) encode(m *slog.Message) ([]byte, error) {
+	action := map[string]interface{}{
+		"create": map[string]string{"_index": h.IndexName(m.Timestamp)},
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(action); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(Document(m, h.config.Host, h.config.Service)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Document returns the ECS document for a message. The host and
+// service names are omitted if empty.
+func Document(m *slog.Message, host, service string) map[string]interface{} {
+	doc := map[string]interface{}{
+		"@timestamp": m.Timestamp.UTC().Format(time.RFC3339Nano),
+		"message":    m.Text,
+		"ecs":        map[string]string{"version": ecsVersion},
+	}
+	logFields := map[string]string{"level": m.Level.String()}
+	if m.Logger != "" {
+		logFields["logger"] = m.Logger
+	}
+	doc["log"] = logFields
+	if m.Err != nil {
+		doc["error"] = map[string]string{"message": m.Err.Error()}
+	}
+	if code := m.Code(); code != "" {
+		doc["event"] = map[string]string{"code": code}
+	}
+	if status := m.Status(); status != 0 {
+		doc["http"] = map[string]interface{}{
+			"response": map[string]int{"status_code": status},
+		}
+	}
+	if host != "" {
+		doc["host"] = map[string]string{"name": host}
+	}
+	if service != "" {
+		doc["service"] = map[string]string{"name": service}
+	}
+	// ECS labels are keywords, so every value is sent as a string
+	labels := make(map[string]string)
+	for _, props := range [][]slog.Property{m.Properties, m.Context} {
+		for _, p := range props {
+			if key := LabelKey(p.Key); key != "" {
+				labels[key] = handlerfmt.Value(p.Value)
+			}
+		}
+	}
+	if len(labels) > 0 {
+		doc["labels"] = labels
+	}
+	return doc
+}
+
+// LabelKey returns the key of the label for a property key. Characters
+// other than letters, digits, underscores and hyphens, including periods,
+// which Elasticsearch would treat as object paths, are replaced with
+// underscores.
+func LabelKey(key string) string {
+	b := []byte(key)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,303 @@
+package elastic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/handlertest"
+)
+
+// bulkDoc is a document received by the bulk API.
+type bulkDoc struct {
+	index string
+	doc   map[string]interface{}
+}
+
+// newBulkServer returns a stand-in for the bulk API, which responds with
+// the statuses before responding normally. If result is not nil, it is
+// called to get the status of each document.
+func newBulkServer(t *testing.T, result func(doc bulkDoc) (status int, errType string), statuses ...int) *handlertest.Server {
+	s := handlertest.NewServer(t, statuses...)
+	s.SetResponder(func(w http.ResponseWriter, r *handlertest.Request) {
+		docs, err := decodeBulk(r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp := bulkResponse{}
+		for _, d := range docs {
+			item := bulkItem{Index: d.index, Status: http.StatusCreated}
+			if result != nil {
+				var errType string
+				if item.Status, errType = result(d); errType != "" {
+					item.Error = &struct {
+						Type   string `json:"type"`
+						Reason string `json:"reason"`
+					}{errType, "rejected " + d.doc["message"].(string)}
+					resp.Errors = true
+				}
+			}
+			resp.Items = append(resp.Items, map[string]bulkItem{"create": item})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	return s
+}
+
+// decodeBulk returns the documents in a bulk request.
+func decodeBulk(r *handlertest.Request) ([]bulkDoc, error) {
+	if r.Path != "/_bulk" {
+		return nil, errors.New("unexpected path " + r.Path)
+	}
+	var docs []bulkDoc
+	scanner := bufio.NewScanner(bytes.NewReader(r.Body))
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			return nil, err
+		}
+		if !scanner.Scan() {
+			return nil, errors.New("missing document")
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, bulkDoc{index: action["create"]["_index"], doc: doc})
+	}
+	return docs, nil
+}
+
+// bulkDocs returns the documents in each request received by the server.
+func bulkDocs(t *testing.T, s *handlertest.Server) [][]bulkDoc {
+	var requests [][]bulkDoc
+	for _, r := range s.Requests() {
+		docs, err := decodeBulk(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, docs)
+	}
+	return requests
+}
+
+// bulkMessages returns the message fields of the documents
+// in each request received by the server.
+func bulkMessages(t *testing.T, s *handlertest.Server) [][]string {
+	var requests [][]string
+	for _, docs := range bulkDocs(t, s) {
+		var texts []string
+		for _, d := range docs {
+			texts = append(texts, d.doc["message"].(string))
+		}
+		requests = append(requests, texts)
+	}
+	return requests
+}
+
+func TestDocument(t *testing.T) {
+	assert := assert.New(t)
+	m := &slog.Message{
+		Timestamp:  handlertest.Time,
+		Level:      slog.LevelWarning,
+		Text:       "disk almost full",
+		Err:        errors.New("quota exceeded"),
+		Logger:     "storage",
+		Properties: []slog.Property{{Key: "path", Value: "/data"}, {Key: "free.space", Value: 12.5}, {Key: "cached", Value: true}},
+		Context:    []slog.Property{{Key: "request", Value: 42}, {Key: "since", Value: handlertest.Time}},
+	}
+	m.SetCode("DISK")
+	m.SetStatus(507)
+	b, err := json.Marshal(Document(m, "host1", "app"))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.JSONEq(`{
+		"@timestamp": "2020-01-02T03:04:05.678901Z",
+		"message": "disk almost full",
+		"ecs": {"version": "`+ecsVersion+`"},
+		"log": {"level": "warn", "logger": "storage"},
+		"error": {"message": "quota exceeded"},
+		"event": {"code": "DISK"},
+		"http": {"response": {"status_code": 507}},
+		"host": {"name": "host1"},
+		"service": {"name": "app"},
+		"labels": {"path": "/data", "free_space": "12.5", "cached": "true", "request": "42", "since": "2020-01-02T03:04:05.678901Z"}
+	}`, string(b))
+
+	b, _ = json.Marshal(Document(handlertest.Messages("hello")[0], "", ""))
+	assert.JSONEq(`{
+		"@timestamp": "2020-01-02T03:04:05.678901Z",
+		"message": "hello",
+		"ecs": {"version": "`+ecsVersion+`"},
+		"log": {"level": "info"}
+	}`, string(b))
+}
+
+func TestLabelKey(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("user_id", LabelKey("user.id"))
+	assert.Equal("a-b_c_d", LabelKey("a-b_c d"))
+}
+
+func TestBulk(t *testing.T) {
+	assert := assert.New(t)
+	s := newBulkServer(t, nil)
+	h, err := New(Config{URL: s.URL + "/", Index: "app", Username: "user", Password: "secret", FlushInterval: time.Hour})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	msgs := handlertest.Messages("one", "two")
+	msgs[1].Timestamp = time.Date(2020, 1, 3, 1, 0, 0, 0, time.FixedZone("+2", 2*3600))
+	h.Handle(msgs)
+	assert.NoError(h.Flush())
+
+	if requests := bulkDocs(t, s); assert.Len(requests, 1) && assert.Len(requests[0], 2) {
+		assert.Equal("app-2020.01.02", requests[0][0].index)
+		assert.Equal("app-2020.01.02", requests[0][1].index)
+		assert.Equal("two", requests[0][1].doc["message"])
+		header := s.Requests()[0].Header
+		user, password, _ := (&http.Request{Header: header}).BasicAuth()
+		assert.Equal("user", user)
+		assert.Equal("secret", password)
+		assert.Equal("application/x-ndjson", header.Get("Content-Type"))
+	}
+}
+
+func TestRetryFailedItems(t *testing.T) {
+	assert := assert.New(t)
+	var rejected int
+	s := newBulkServer(t, func(d bulkDoc) (int, string) {
+		switch d.doc["message"] {
+		case "busy":
+			if rejected++; rejected <= 2 {
+				return http.StatusTooManyRequests, "es_rejected_execution_exception"
+			}
+		case "bad":
+			return http.StatusBadRequest, "mapper_parsing_exception"
+		}
+		return http.StatusCreated, ""
+	})
+	var errs []error
+	var mu sync.Mutex
+	h, err := New(Config{
+		URL:           s.URL,
+		APIKey:        "key",
+		FlushInterval: time.Hour,
+		MinBackoff:    time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	h.Handle(handlertest.Messages("ok", "busy", "bad"))
+	err = h.Flush()
+	if assert.IsType(&ItemError{}, err) {
+		ierr := err.(*ItemError)
+		assert.Equal(http.StatusBadRequest, ierr.Status)
+		assert.Equal("mapper_parsing_exception", ierr.Type)
+		assert.Equal("elastic: slog-2020.01.02: mapper_parsing_exception: rejected bad", ierr.Error())
+	}
+	assert.Equal([][]string{{"ok", "busy", "bad"}, {"busy"}, {"busy"}}, bulkMessages(t, s))
+	assert.Equal("ApiKey key", s.Requests()[0].Header.Get("Authorization"))
+
+	// the error is returned once, and reported by the time
+	// the handler is closed
+	assert.NoError(h.Flush())
+	assert.NoError(h.Close())
+	mu.Lock()
+	assert.Len(errs, 1)
+	mu.Unlock()
+}
+
+func TestRetryRequest(t *testing.T) {
+	assert := assert.New(t)
+	s := newBulkServer(t, nil, http.StatusServiceUnavailable)
+	h, err := New(Config{URL: s.URL, FlushInterval: time.Hour, MinBackoff: time.Millisecond})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	h.Handle(handlertest.Messages("one"))
+	assert.NoError(h.Flush())
+	assert.Equal([][]string{{"one"}, {"one"}}, bulkMessages(t, s))
+
+	// client errors are not retried
+	s.AddStatuses(http.StatusUnauthorized)
+	h.Handle(handlertest.Messages("two"))
+	err = h.Flush()
+	if assert.IsType(&StatusError{}, err) {
+		assert.Equal(http.StatusUnauthorized, err.(*StatusError).StatusCode)
+	}
+	assert.Len(s.Requests(), 3)
+}
+
+func TestConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	var mu sync.Mutex
+	var active, maxActive int
+	s := handlertest.NewServer(t)
+	s.SetResponder(func(w http.ResponseWriter, r *handlertest.Request) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	})
+
+	h, err := New(Config{URL: s.URL, BatchSize: 1, Concurrency: 2, FlushInterval: time.Hour})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	h.Handle(handlertest.Messages("1", "2", "3", "4", "5", "6"))
+	assert.NoError(h.Flush())
+	assert.Len(s.Requests(), 6)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(2, maxActive)
+}
+
+func TestConfigFactory(t *testing.T) {
+	assert := assert.New(t)
+	s := newBulkServer(t, nil)
+	l := handlertest.ConfigLogger(t, "elastic", `{"url": "`+s.URL+`", "index": "cfg", "service": "svc", "flush_interval": "1h"}`)
+	l.Info(context.Background(), "configured", slog.WithValue("a", "b"))
+	assert.NoError(l.Flush())
+
+	if requests := bulkDocs(t, s); assert.Len(requests, 1) && assert.Len(requests[0], 1) {
+		d := requests[0][0]
+		assert.True(strings.HasPrefix(d.index, "cfg-"))
+		assert.Equal(map[string]interface{}{"name": "svc"}, d.doc["service"])
+		assert.Equal(map[string]interface{}{"a": "b"}, d.doc["labels"])
+	}
+
+	var c Config
+	assert.Error(json.Unmarshal([]byte(`{"url": "http://localhost", "min_backoff": "soon"}`), &c))
+	_, err := New(Config{})
+	assert.Equal(errNoURL, err)
+}
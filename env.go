@@ -0,0 +1,109 @@
+package slog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment variables read by ConfigureFromEnv.
+const (
+	EnvLevel  = "SLOG_LEVEL"  // minimum level of the default logger, eg "debug"
+	EnvFormat = "SLOG_FORMAT" // output format of the default logger, eg "json"
+	EnvLevels = "SLOG_LEVELS" // minimum levels of named loggers, eg "db=debug,http=warn"
+)
+
+var (
+	errMissingLoggerName = errors.New("missing logger name")
+	errMissingLevel      = errors.New("missing level")
+)
+
+// EnvError describes a malformed environment variable.
+type EnvError struct {
+	Name  string // Name of the environment variable
+	Value string // The malformed value, or part of the value
+	Err   error  // The reason the value is malformed
+}
+
+func (e *EnvError) Error() string {
+	return fmt.Sprintf("%s: %q: %v", e.Name, e.Value, e.Err)
+}
+
+// EnvErrors is returned by ConfigureFromEnv when one or more
+// environment variables are malformed.
+type EnvErrors []*EnvError
+
+func (e EnvErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ConfigureFromEnv configures the default logger and named loggers from
+// environment variables. SLOG_LEVEL sets the minimum level of the default
+// logger, SLOG_FORMAT sets its output format, and SLOG_LEVELS sets the minimum
+// levels of named loggers using a comma-separated list of name=level pairs.
+//
+//	SLOG_LEVEL=info SLOG_FORMAT=json SLOG_LEVELS="db=debug,http=warn"
+//
+// Variables that are not set are ignored. Malformed values are reported in
+// the returned error, which has type EnvErrors. All well-formed values are
+// applied even if other values are malformed.
+func ConfigureFromEnv() error {
+	return configureFromEnv(os.Getenv)
+}
+
+func configureFromEnv(getenv func(string) string) error {
+	var errs EnvErrors
+	addErr := func(name, value string, err error) {
+		errs = append(errs, &EnvError{Name: name, Value: value, Err: err})
+	}
+
+	if value := strings.TrimSpace(getenv(EnvLevel)); value != "" {
+		var level Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			addErr(EnvLevel, value, err)
+		} else {
+			SetMinLevel(level)
+		}
+	}
+
+	if value := strings.TrimSpace(getenv(EnvFormat)); value != "" {
+		if f, err := NewFormatter(value); err != nil {
+			addErr(EnvFormat, value, err)
+		} else {
+			SetFormatter(f)
+		}
+	}
+
+	for _, spec := range strings.Split(getenv(EnvLevels), ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parts := strings.SplitN(spec, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			addErr(EnvLevels, spec, errMissingLoggerName)
+			continue
+		}
+		if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+			addErr(EnvLevels, spec, errMissingLevel)
+			continue
+		}
+		var level Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(parts[1]))); err != nil {
+			addErr(EnvLevels, spec, err)
+			continue
+		}
+		Named(name).SetMinLevel(level)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
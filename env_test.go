@@ -0,0 +1,56 @@
+package slog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureFromEnv(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+
+	env := map[string]string{
+		EnvLevel:  "Debug",
+		EnvFormat: "json",
+		EnvLevels: " test-env-db=trace , test-env-http=WARN,",
+	}
+	assert.NoError(configureFromEnv(func(name string) string { return env[name] }))
+	assert.Equal(LevelDebug, Default.LevelVar().Level())
+	assert.Equal(JSONFormatter{}, Default.(*loggerImpl).format)
+	assert.Equal(LevelTrace, Named("test-env-db").LevelVar().Level())
+	assert.Equal(LevelWarning, Named("test-env-http").LevelVar().Level())
+}
+
+func TestConfigureFromEnvErrors(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+
+	env := map[string]string{
+		EnvLevel:  "verbose",
+		EnvFormat: "xml",
+		EnvLevels: "test-env-ok=error,=debug,test-env-x,test-env-y=loud",
+	}
+	err := configureFromEnv(func(name string) string { return env[name] })
+	errs, ok := err.(EnvErrors)
+	assert.True(ok)
+	assert.Equal(5, len(errs))
+	assert.Equal(EnvLevel, errs[0].Name)
+	assert.Equal("verbose", errs[0].Value)
+	assert.Equal(EnvFormat, errs[1].Name)
+	assert.Equal("=debug", errs[2].Value)
+	assert.Equal("test-env-x", errs[3].Value)
+	assert.Equal("test-env-y=loud", errs[4].Value)
+	assert.Contains(err.Error(), `SLOG_LEVELS: "test-env-y=loud": invalid level`)
+
+	// well-formed values are still applied
+	assert.Equal(LevelInfo, Default.LevelVar().Level())
+	assert.Equal(LevelError, Named("test-env-ok").LevelVar().Level())
+}
+
+func TestConfigureFromEnvEmpty(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(configureFromEnv(func(name string) string { return "" }))
+}
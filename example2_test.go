@@ -17,7 +17,10 @@ func (h *ExternalHandler) Handle(msgs []*slog.Message) {
 }
 
 func ExampleAddHandler() {
-	slog.AddHandler(&ExternalHandler{})
+	reg := slog.AddHandler(&ExternalHandler{})
+
+	// ... later, when the handler is no longer required ...
+	reg.Remove()
 }
 
 func ExampleNewWriter(ctx context.Context) {
@@ -106,3 +109,73 @@ func doAnotherThing() error {
 func doOneMoreThing() error {
 	return nil
 }
+
+// AuditHandler sends audit messages to a separate audit trail.
+type AuditHandler struct {
+	// ... details for accessing audit trail ...
+}
+
+// LevelAudit is a custom level for audit messages.
+const LevelAudit = slog.LevelWarning + 5
+
+func (h *AuditHandler) Handle(msgs []*slog.Message) {
+	for _, m := range msgs {
+		if m.Level == LevelAudit {
+			// ... send m to the audit trail ...
+		}
+	}
+}
+
+func ExampleRegisterLevel() {
+	// audit messages are always logged, regardless of the minimum level
+	slog.RegisterLevel(slog.LevelDef{
+		Name:   "audit",
+		Level:  LevelAudit,
+		Color:  slog.ColorMagenta,
+		Always: true,
+	})
+	slog.AddHandler(&AuditHandler{})
+
+	ctx := context.Background()
+	slog.Log(ctx, LevelAudit, "user logged in", slog.WithValue("user", "fnurk"))
+}
+
+func ExampleWithMinLevel() {
+	// middleware that enables debug logging for a single request
+	// when the request has a "debug" query parameter
+	debugMiddleware := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("debug") != "" {
+				ctx := slog.WithMinLevel(r.Context(), slog.LevelDebug)
+				r = r.WithContext(ctx)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	http.Handle("/", debugMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// logged only for requests with the "debug" query parameter
+		slog.Debug(r.Context(), "handling request", slog.WithValue("path", r.URL.Path))
+	})))
+}
+
+func ExampleWithBuffer() {
+	// middleware that outputs the debug messages for a request
+	// only if an error is logged while handling the request
+	bufferMiddleware := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := slog.WithBuffer(r.Context(), slog.LevelDebug, slog.LevelError)
+			defer slog.FlushBuffer(ctx)
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	http.Handle("/", bufferMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Debug(r.Context(), "handling request", slog.WithValue("path", r.URL.Path))
+		if r.URL.Path != "/" {
+			// the debug message above is output before this message
+			slog.Error(r.Context(), "not found", slog.WithValue("path", r.URL.Path))
+			http.NotFound(w, r)
+		}
+	})))
+}
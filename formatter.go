@@ -0,0 +1,223 @@
+package slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spkg/slog/logfmt"
+)
+
+var (
+	errUnknownFormat = errors.New("unknown format")
+)
+
+// Formatter is an interface for formatting messages written to
+// a Logger's output. Each call to Format writes one complete message,
+// including the terminating new line.
+type Formatter interface {
+	Format(w io.Writer, m *Message) error
+}
+
+// NewFormatter returns the formatter for the named format. Supported
+// formats are "logfmt" and "json".
+func NewFormatter(name string) (Formatter, error) {
+	switch strings.ToLower(name) {
+	case "logfmt":
+		return LogfmtFormatter{}, nil
+	case "json":
+		return JSONFormatter{}, nil
+	}
+	return nil, errUnknownFormat
+}
+
+// Special values for the layout of a TimeFormat.
+const (
+	TimeUnix      = "unix"      // Seconds since the Unix epoch
+	TimeUnixMilli = "unixmilli" // Milliseconds since the Unix epoch
+	TimeOmit      = "omit"      // Timestamp is not written
+)
+
+// TimeFormat describes how a formatter writes times. The zero value
+// uses the formatter's default layout, in the time's own location.
+//
+//	slog.SetFormatter(slog.JSONFormatter{
+//		Time: slog.TimeFormat{Layout: time.RFC3339, Location: time.UTC},
+//	})
+type TimeFormat struct {
+	Layout   string         // Layout for time.Time.Format, or TimeUnix, TimeUnixMilli or TimeOmit
+	Location *time.Location // Location for times, eg time.UTC or time.Local; nil leaves times unchanged
+}
+
+// IsZero reports whether tf is the zero value, which
+// means that the formatter's default is used.
+func (tf TimeFormat) IsZero() bool {
+	return tf.Layout == "" && tf.Location == nil
+}
+
+// format formats t, using defaultLayout if no layout is set. Reports whether
+// the result is a number, and returns ok=false if the time is omitted.
+func (tf TimeFormat) format(t time.Time, defaultLayout string) (s string, numeric bool, ok bool) {
+	if tf.Location != nil {
+		t = t.In(tf.Location)
+	}
+	switch tf.Layout {
+	case TimeOmit:
+		return "", false, false
+	case TimeUnix:
+		return strconv.FormatInt(t.Unix(), 10), true, true
+	case TimeUnixMilli:
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10), true, true
+	case "":
+		return t.Format(defaultLayout), false, true
+	}
+	return t.Format(tf.Layout), false, true
+}
+
+// formatValue formats a time.Time property value. Values are never omitted.
+func (tf TimeFormat) formatValue(t time.Time, defaultLayout string) (s string, numeric bool) {
+	if tf.Layout == TimeOmit {
+		tf.Layout = ""
+	}
+	s, numeric, _ = tf.format(t, defaultLayout)
+	return s, numeric
+}
+
+// LogfmtFormatter formats messages in logfmt format. This is the
+// default format. See https://brandur.org/logfmt for a description
+// of logfmt.
+//
+// The zero value writes timestamps and time.Time property values
+// using the layout in logfmt.TimeFormat. Each formatter can have
+// its own time formats, so that loggers and sinks in the same program
+// can write times differently.
+type LogfmtFormatter struct {
+	Time         TimeFormat // Format of message timestamps
+	PropertyTime TimeFormat // Format of time.Time property values; TimeOmit is ignored
+}
+
+// Format implements the Formatter interface.
+func (f LogfmtFormatter) Format(w io.Writer, m *Message) error {
+	buf := f.buffer(m)
+	defer buf.Reset()
+	buf.WriteEOL()
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// buffer returns the message in logfmt format.
+func (f LogfmtFormatter) buffer(m *Message) logfmt.Buffer {
+	var buf logfmt.Buffer
+	if !f.PropertyTime.IsZero() {
+		buf.FormatTime = func(t time.Time) string {
+			s, _ := f.PropertyTime.formatValue(t, logfmt.TimeFormat)
+			return s
+		}
+	}
+	if f.Time.IsZero() {
+		buf.WriteTimestamp(m.Timestamp)
+	} else if s, _, ok := f.Time.format(m.Timestamp, logfmt.TimeFormat); ok {
+		buf.WriteValue(s)
+	}
+	m.writeLogfmt(&buf)
+	return buf
+}
+
+// JSONFormatter formats each message as a JSON object on a single line.
+// The object contains "time", "level" and "msg" fields, followed by "error",
+// "logger", properties, context, "code" and "status" if present.
+//
+// The zero value writes timestamps and time.Time property values in
+// RFC3339 format with nanoseconds. Timestamps in TimeUnix or TimeUnixMilli
+// format are written as JSON numbers.
+type JSONFormatter struct {
+	Time         TimeFormat // Format of message timestamps
+	PropertyTime TimeFormat // Format of time.Time property values; TimeOmit is ignored
+}
+
+// Format implements the Formatter interface.
+func (f JSONFormatter) Format(w io.Writer, m *Message) error {
+	var buf bytes.Buffer
+	f.write(&buf, m)
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// write writes the message to buf as a JSON object.
+func (f JSONFormatter) write(buf *bytes.Buffer, m *Message) {
+	start := buf.Len()
+	field := func(key string, value interface{}) {
+		if buf.Len() > start+1 {
+			buf.WriteByte(',')
+		}
+		if t, ok := value.(time.Time); ok && !f.PropertyTime.IsZero() {
+			s, numeric := f.PropertyTime.formatValue(t, time.RFC3339Nano)
+			value = jsonTime{s, numeric}
+		}
+		writeJSONField(buf, key, value)
+	}
+
+	buf.WriteByte('{')
+	if s, numeric, ok := f.Time.format(m.Timestamp, time.RFC3339Nano); ok {
+		field("time", jsonTime{s, numeric})
+	}
+	field("level", m.Level.String())
+	field("msg", m.Text)
+	if m.Err != nil {
+		field("error", m.Err.Error())
+	}
+	if m.Logger != "" {
+		field("logger", m.Logger)
+	}
+	for _, p := range m.Properties {
+		field(p.Key, p.Value)
+	}
+	for _, p := range m.Context {
+		field(p.Key, p.Value)
+	}
+	if m.code != "" {
+		field("code", m.code)
+	}
+	if m.status != 0 {
+		field("status", m.status)
+	}
+	buf.WriteByte('}')
+}
+
+// jsonTime is a formatted time, written as a JSON number or string.
+type jsonTime struct {
+	s       string
+	numeric bool
+}
+
+func (t jsonTime) MarshalJSON() ([]byte, error) {
+	if t.numeric {
+		return []byte(t.s), nil
+	}
+	return json.Marshal(t.s)
+}
+
+// writeJSONField writes a key value pair to buf. Values that cannot be
+// represented in JSON are written as strings.
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	b, _ := json.Marshal(key)
+	buf.Write(b)
+	buf.WriteByte(':')
+
+	if err, ok := value.(error); ok {
+		if _, ok := value.(json.Marshaler); !ok {
+			value = err.Error()
+		}
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(b)
+}
@@ -0,0 +1,132 @@
+package slog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+)
+
+func TestNewFormatter(t *testing.T) {
+	assert := assert.New(t)
+	f, err := NewFormatter("logfmt")
+	assert.NoError(err)
+	assert.Equal(LogfmtFormatter{}, f)
+	f, err = NewFormatter("JSON")
+	assert.NoError(err)
+	assert.Equal(JSONFormatter{}, f)
+	_, err = NewFormatter("xml")
+	assert.Error(err)
+}
+
+func TestJSONFormatter(t *testing.T) {
+	assert := assert.New(t)
+	m := &Message{
+		Timestamp: time.Unix(1234567890, 987654321).UTC(),
+		Level:     LevelError,
+		Text:      "This is the message",
+		Err:       errors.New("Error message"),
+		Logger:    "db",
+		Properties: []Property{
+			{"a", 1},
+			{"err", errors.New("prop error")},
+			{"ch", make(chan int)},
+		},
+		Context: []Property{
+			{"e", "f"},
+		},
+		code:   "CODE",
+		status: 400,
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(JSONFormatter{}.Format(&buf, m))
+	expected := `{"time":"2009-02-13T23:31:30.987654321Z","level":"error","msg":"This is the message",` +
+		`"error":"Error message","logger":"db","a":1,"err":"prop error","ch":"` +
+		fmt.Sprint(m.Properties[2].Value) + `","e":"f","code":"CODE","status":400}` + "\n"
+	assert.Equal(expected, buf.String())
+}
+
+func TestSetFormatter(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	var buf bytes.Buffer
+	l.SetOutput(&buf)
+	l.SetFormatter(JSONFormatter{})
+	ctx := context.Background()
+	l.Info(ctx, "message")
+	assert.Contains(buf.String(), `"level":"info","msg":"message"}`)
+
+	buf.Reset()
+	l.SetFormatter(nil)
+	l.Info(ctx, "message")
+	assert.Contains(buf.String(), ` info msg=message`)
+}
+
+func TestTimeFormat(t *testing.T) {
+	assert := assert.New(t)
+	est := time.FixedZone("EST", -5*3600)
+	m := &Message{
+		Timestamp: time.Date(2016, 11, 30, 12, 30, 28, 763876243, est),
+		Level:     LevelInfo,
+		Text:      "message",
+		Properties: []Property{
+			{"t", time.Date(2016, 11, 30, 17, 30, 28, 0, time.UTC)},
+		},
+	}
+	testCases := []struct {
+		formatter Formatter
+		expected  string
+	}{
+		{
+			formatter: LogfmtFormatter{},
+			expected:  "2016-11-30T12:30:28.763876-0500 info msg=message t=2016-11-30T17:30:28.000000+0000\n",
+		},
+		{
+			formatter: LogfmtFormatter{
+				Time:         TimeFormat{Layout: time.RFC3339, Location: time.UTC},
+				PropertyTime: TimeFormat{Location: est},
+			},
+			expected: "2016-11-30T17:30:28Z info msg=message t=2016-11-30T12:30:28.000000-0500\n",
+		},
+		{
+			formatter: LogfmtFormatter{
+				Time:         TimeFormat{Layout: "2006-01-02 15:04:05.000"},
+				PropertyTime: TimeFormat{Layout: TimeOmit},
+			},
+			expected: "\"2016-11-30 12:30:28.763\" info msg=message t=2016-11-30T17:30:28.000000+0000\n",
+		},
+		{
+			formatter: LogfmtFormatter{Time: TimeFormat{Layout: TimeOmit}},
+			expected:  "info msg=message t=2016-11-30T17:30:28.000000+0000\n",
+		},
+		{
+			formatter: JSONFormatter{},
+			expected:  `{"time":"2016-11-30T12:30:28.763876243-05:00","level":"info","msg":"message","t":"2016-11-30T17:30:28Z"}` + "\n",
+		},
+		{
+			formatter: JSONFormatter{
+				Time:         TimeFormat{Layout: TimeUnixMilli},
+				PropertyTime: TimeFormat{Layout: TimeUnix},
+			},
+			expected: `{"time":1480527028763,"level":"info","msg":"message","t":1480527028}` + "\n",
+		},
+		{
+			formatter: JSONFormatter{
+				Time:         TimeFormat{Layout: TimeOmit},
+				PropertyTime: TimeFormat{Layout: time.Kitchen, Location: est},
+			},
+			expected: `{"level":"info","msg":"message","t":"12:30PM"}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		assert.NoError(tc.formatter.Format(&buf, m))
+		assert.Equal(tc.expected, buf.String())
+	}
+}
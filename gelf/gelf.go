@@ -0,0 +1,448 @@
+// Package gelf provides a slog handler that sends messages to Graylog
+// or any other server that accepts the Graylog Extended Log Format (GELF)
+// version 1.1, over UDP or TCP.
+//
+//	h, err := gelf.Dial(gelf.Config{Network: "udp", Addr: "graylog.example.com:12201"})
+//	if err != nil {
+//		return err
+//	}
+//	defer h.Close()
+//	slog.AddHandler(h)
+//
+// The package registers the "gelf" handler type for use in a slog.Config,
+// with a Config in JSON format as its parameters.
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/handlerfmt"
+	"github.com/spkg/slog/internal/jsonconfig"
+	"github.com/spkg/slog/internal/redial"
+)
+
+// Defaults for the configuration.
+const (
+	DefaultChunkSize = 1420 // Fits in an Ethernet frame with IP and UDP headers
+	DefaultAddr      = "127.0.0.1:12201"
+	DefaultTimeout   = 5 * time.Second
+)
+
+// maxChunks is the maximum number of chunks in a chunked message.
+const maxChunks = 128
+
+// chunkHeaderSize is the size of the header of each chunk.
+const chunkHeaderSize = 12
+
+// reservedFields are the names of additional fields that
+// cannot be used by properties.
+var reservedFields = map[string]bool{
+	"_id":     true,
+	"_error":  true,
+	"_logger": true,
+	"_code":   true,
+	"_status": true,
+}
+
+// stackKey is the key of the property that holds a stack trace,
+// which is sent in the full message.
+const stackKey = "stack"
+
+var (
+	errUnknownNetwork     = errors.New("gelf: unknown network")
+	errUnknownCompression = errors.New("gelf: unknown compression")
+	errTooManyChunks      = errors.New("gelf: message too large")
+	errChunkSize          = errors.New("gelf: chunk size too small")
+	errNotConnected       = errors.New("gelf: not connected")
+)
+
+// Config describes the GELF server and the messages sent to it.
+type Config struct {
+	Network     string `json:"network,omitempty"`     // "udp" (default) or "tcp"
+	Addr        string `json:"addr,omitempty"`        // Server address, default "127.0.0.1:12201"
+	Host        string `json:"host,omitempty"`        // Host field, default is the system host name
+	Compression string `json:"compression,omitempty"` // UDP compression: "gzip" (default), "zlib" or "none"
+	ChunkSize   int    `json:"chunk_size,omitempty"`  // Maximum UDP datagram size, default 1420
+
+	// Timeout of connecting and of sending each message, default
+	// DefaultTimeout. In the JSON format it is a string such as "5s".
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface,
+// parsing the timeout with time.ParseDuration.
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type config Config
+	return jsonconfig.Unmarshal(b, (*config)(c), "timeout")
+}
+
+// Handler is a slog.Handler that sends messages in GELF format.
+//
+// Over UDP, each message is compressed and sent in one datagram, or in up to
+// 128 chunks if it does not fit in one datagram. Larger messages are dropped.
+// Over TCP, each message is sent uncompressed and terminated by a null byte.
+// If sending a message fails, the handler reconnects and tries again once.
+// If sending times out, the message is dropped without trying again, and the
+// handler reconnects when the next message is sent, so that a server that is
+// not reading holds up the logger for at most the timeout. After a failed
+// attempt to reconnect, messages are dropped without trying to connect for
+// one second, doubling after each consecutive failure up to a minute.
+// A Handler is safe for concurrent use.
+type Handler struct {
+	config Config
+
+	mu      sync.Mutex // protects the following fields
+	conn    net.Conn   // nil after a TCP connection fails
+	backoff redial.Backoff
+	dropped int64
+	closed  bool
+}
+
+func init() {
+	slog.RegisterHandlerFactory("gelf", func(params json.RawMessage) (slog.Handler, error) {
+		var c Config
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &c); err != nil {
+				return nil, err
+			}
+		}
+		return Dial(c)
+	})
+}
+
+// Dial connects to the GELF server described by the configuration.
+func Dial(c Config) (*Handler, error) {
+	switch c.Network {
+	case "":
+		c.Network = "udp"
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errUnknownNetwork
+	}
+	switch c.Compression {
+	case "":
+		c.Compression = "gzip"
+	case "gzip", "zlib", "none":
+	default:
+		return nil, errUnknownCompression
+	}
+	if c.ChunkSize == 0 {
+		c.ChunkSize = DefaultChunkSize
+	}
+	if c.ChunkSize <= chunkHeaderSize {
+		return nil, errChunkSize
+	}
+	if c.Addr == "" {
+		c.Addr = DefaultAddr
+	}
+	if c.Host == "" {
+		c.Host, _ = os.Hostname()
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	h := &Handler{config: c}
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// connect connects to the server.
+func (h *Handler) connect() error {
+	conn, err := net.DialTimeout(h.config.Network, h.config.Addr, h.config.Timeout)
+	if err != nil {
+		return err
+	}
+	h.conn = conn
+	return nil
+}
+
+// Handle implements the slog.Handler interface. Messages that cannot
+// be sent are dropped.
+func (h *Handler) Handle(msgs []*slog.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	for _, m := range msgs {
+		b, err := Encode(m, h.config.Host)
+		if err == nil {
+			err = h.write(b)
+		}
+		if err != nil {
+			h.dropped++
+		}
+	}
+}
+
+// Dropped returns the number of messages dropped because
+// they could not be encoded or sent.
+func (h *Handler) Dropped() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// write sends an encoded message, reconnecting if needed.
+func (h *Handler) write(b []byte) error {
+	if h.conn == nil {
+		if err := h.reconnect(); err != nil {
+			return err
+		}
+	}
+	err := h.send(b)
+	if err == nil || !h.isStream() {
+		return err
+	}
+	// part of the message may have been written,
+	// so the connection cannot be used for the next message
+	h.conn.Close()
+	h.conn = nil
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return err
+	}
+	// reconnect and try once more
+	if err := h.reconnect(); err != nil {
+		return err
+	}
+	if err := h.send(b); err != nil {
+		h.conn.Close()
+		h.conn = nil
+		return err
+	}
+	return nil
+}
+
+// reconnect connects to the server, unless an attempt
+// failed recently, in which case it returns errNotConnected.
+func (h *Handler) reconnect() error {
+	now := time.Now()
+	if !h.backoff.Ready(now) {
+		return errNotConnected
+	}
+	if err := h.connect(); err != nil {
+		h.backoff.Fail(now)
+		return err
+	}
+	h.backoff.Reset()
+	return nil
+}
+
+// Close closes the connection to the server.
+func (h *Handler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	if h.conn == nil {
+		return nil
+	}
+	return h.conn.Close()
+}
+
+func (h *Handler) isStream() bool {
+	return strings.HasPrefix(h.config.Network, "tcp")
+}
+
+// send sends an encoded message.
+func (h *Handler) send(b []byte) error {
+	h.conn.SetWriteDeadline(time.Now().Add(h.config.Timeout))
+	if h.isStream() {
+		_, err := h.conn.Write(append(b, 0))
+		return err
+	}
+	b, err := compress(b, h.config.Compression)
+	if err != nil {
+		return err
+	}
+	if len(b) <= h.config.ChunkSize {
+		_, err := h.conn.Write(b)
+		return err
+	}
+	chunks, err := chunk(b, h.config.ChunkSize)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if _, err := h.conn.Write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress compresses the message using the named compression.
+func compress(b []byte, compression string) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	default:
+		return b, nil
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chunk splits a message into chunks of at most size bytes, each with a
+// header containing the magic bytes, a message ID shared by all chunks,
+// the sequence number of the chunk, and the number of chunks.
+func chunk(b []byte, size int) ([][]byte, error) {
+	dataSize := size - chunkHeaderSize
+	count := (len(b) + dataSize - 1) / dataSize
+	if count > maxChunks {
+		return nil, errTooManyChunks
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	chunks := make([][]byte, 0, count)
+	for seq := 0; seq < count; seq++ {
+		data := b[seq*dataSize:]
+		if len(data) > dataSize {
+			data = data[:dataSize]
+		}
+		c := make([]byte, 0, chunkHeaderSize+len(data))
+		c = append(c, 0x1e, 0x0f)
+		c = append(c, id[:]...)
+		c = append(c, byte(seq), byte(count))
+		c = append(c, data...)
+		chunks = append(chunks, c)
+	}
+	return chunks, nil
+}
+
+// Encode returns the message as a GELF 1.1 JSON object. The message text is
+// the short message. If the message has an error that provides more detail
+// when formatted with "%+v", or a "stack" property, the full message is the
+// text followed by the detailed error and the stack trace. Other properties,
+// context values, the error, logger name, code and status are additional
+// fields, which are prefixed with an underscore. See FieldName for how the
+// fields of properties are named.
+func Encode(m *slog.Message, host string) ([]byte, error) {
+	fields := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": m.Text,
+		"timestamp":     json.Number(fmt.Sprintf("%d.%03d", m.Timestamp.Unix(), m.Timestamp.Nanosecond()/int(time.Millisecond))),
+		"level":         handlerfmt.Severity(m.Level),
+	}
+	full := []string{m.Text}
+	if m.Err != nil {
+		text := m.Err.Error()
+		fields["_error"] = text
+		if detail := fmt.Sprintf("%+v", m.Err); detail != text {
+			full = append(full, detail)
+		}
+	}
+	if m.Logger != "" {
+		fields["_logger"] = m.Logger
+	}
+	for _, props := range [][]slog.Property{m.Properties, m.Context} {
+		for _, p := range props {
+			if p.Key == stackKey {
+				full = append(full, fmt.Sprint(p.Value))
+				continue
+			}
+			if name := FieldName(p.Key); name != "" {
+				fields[name] = fieldValue(p.Value)
+			}
+		}
+	}
+	if len(full) > 1 {
+		fields["full_message"] = strings.Join(full, "\n")
+	}
+	if code := m.Code(); code != "" {
+		fields["_code"] = code
+	}
+	if m.Status() != 0 {
+		fields["_status"] = m.Status()
+	}
+	return json.Marshal(fields)
+}
+
+// FieldName returns the name of the additional field for a property key.
+// Characters other than letters, digits, underscores, hyphens and periods are
+// replaced with underscores, and the name is prefixed with an underscore.
+// The reserved name "_id", and the names of the fields for the error, logger
+// name, code and status of a message, are suffixed with another underscore,
+// so that "_error" becomes "_error_". Returns an empty string if the key is
+// empty.
+func FieldName(key string) string {
+	if key == "" {
+		return ""
+	}
+	b := make([]byte, 0, len(key)+1)
+	b = append(b, '_')
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	if reservedFields[string(b)] {
+		b = append(b, '_')
+	}
+	return string(b)
+}
+
+// fieldValue returns a property value as a JSON number or string,
+// as additional fields cannot contain objects or arrays. Floating
+// point values that are not finite, which JSON cannot represent,
+// are formatted as strings such as "NaN" and "+Inf".
+func fieldValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return v
+	case float32:
+		if f := float64(v); math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 32)
+		}
+		return v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return v
+	case string:
+		return v
+	case bool:
+		return fmt.Sprint(v)
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
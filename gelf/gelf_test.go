@@ -0,0 +1,327 @@
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/handlertest"
+)
+
+// stackError is an error that formats with a stack trace for "%+v".
+type stackError struct{}
+
+func (stackError) Error() string { return "quota exceeded" }
+
+func (e stackError) Format(s fmt.State, verb rune) {
+	io.WriteString(s, e.Error())
+	if verb == 'v' && s.Flag('+') {
+		io.WriteString(s, "\nmain.main\n\tmain.go:10")
+	}
+}
+
+func testMessage() *slog.Message {
+	m := &slog.Message{
+		Timestamp:  handlertest.Time,
+		Level:      slog.LevelWarning,
+		Text:       "disk almost full",
+		Err:        stackError{},
+		Logger:     "storage",
+		Properties: []slog.Property{{Key: "path", Value: "/data"}, {Key: "free space", Value: 12.5}, {Key: "id", Value: 7}},
+		Context:    []slog.Property{{Key: "request", Value: 42}},
+	}
+	m.SetCode("DISK")
+	return m
+}
+
+func decode(t *testing.T, b []byte) map[string]interface{} {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestEncode(t *testing.T) {
+	assert := assert.New(t)
+	b, err := Encode(testMessage(), "host")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Contains(string(b), `"timestamp":1577934245.678`)
+	assert.Equal(map[string]interface{}{
+		"version":       "1.1",
+		"host":          "host",
+		"short_message": "disk almost full",
+		"full_message":  "disk almost full\nquota exceeded\nmain.main\n\tmain.go:10",
+		"timestamp":     1577934245.678,
+		"level":         4.0,
+		"_error":        "quota exceeded",
+		"_logger":       "storage",
+		"_path":         "/data",
+		"_free_space":   12.5,
+		"_id_":          7.0,
+		"_request":      42.0,
+		"_code":         "DISK",
+	}, decode(t, b))
+
+	m := &slog.Message{
+		Timestamp:  handlertest.Time,
+		Level:      slog.LevelError,
+		Text:       "handler panic",
+		Err:        errors.New("plain"),
+		Properties: []slog.Property{{Key: "stack", Value: "goroutine 1"}},
+	}
+	fields := decode(t, mustEncode(t, m))
+	assert.Equal("handler panic\ngoroutine 1", fields["full_message"])
+	assert.Equal(3.0, fields["level"])
+	assert.NotContains(fields, "_stack")
+
+	fields = decode(t, mustEncode(t, &slog.Message{Timestamp: handlertest.Time, Level: slog.LevelInfo, Text: "hello"}))
+	assert.NotContains(fields, "full_message")
+	assert.Equal(6.0, fields["level"])
+
+	// properties do not replace the fields of the message
+	m = testMessage()
+	m.Properties = []slog.Property{{Key: "error", Value: "property"}, {Key: "code", Value: "X"}}
+	fields = decode(t, mustEncode(t, m))
+	assert.Equal("quota exceeded", fields["_error"])
+	assert.Equal("property", fields["_error_"])
+	assert.Equal("DISK", fields["_code"])
+	assert.Equal("X", fields["_code_"])
+
+	// values that are not finite are sent as strings
+	m = testMessage()
+	m.Properties = []slog.Property{{Key: "nan", Value: math.NaN()}, {Key: "inf", Value: float32(math.Inf(-1))}}
+	fields = decode(t, mustEncode(t, m))
+	assert.Equal("NaN", fields["_nan"])
+	assert.Equal("-Inf", fields["_inf"])
+}
+
+func mustEncode(t *testing.T, m *slog.Message) []byte {
+	b, err := Encode(m, "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFieldName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("_user_id", FieldName("user id"))
+	assert.Equal("_a.b-c_d", FieldName("a.b-c_d"))
+	assert.Equal("_id_", FieldName("id"))
+	assert.Equal("_error_", FieldName("error"))
+	assert.Equal("_code_", FieldName("code"))
+	assert.Equal("", FieldName(""))
+}
+
+func TestChunk(t *testing.T) {
+	assert := assert.New(t)
+	b := bytes.Repeat([]byte("x"), 25)
+	chunks, err := chunk(b, 22)
+	if !assert.NoError(err) {
+		return
+	}
+	if assert.Len(chunks, 3) {
+		for i, c := range chunks {
+			assert.Equal([]byte{0x1e, 0x0f}, c[:2])
+			assert.Equal(chunks[0][2:10], c[2:10])
+			assert.Equal([]byte{byte(i), 3}, c[10:12])
+		}
+		assert.Len(chunks[0], 22)
+		assert.Len(chunks[2], 17)
+	}
+
+	_, err = chunk(make([]byte, 129), 13)
+	assert.Equal(errTooManyChunks, err)
+}
+
+// readUDP reads a message from conn, reassembling chunks
+// and decompressing it.
+func readUDP(t *testing.T, conn net.PacketConn) map[string]interface{} {
+	var parts [][]byte
+	for {
+		b := handlertest.ReadPacket(t, conn)
+		if len(b) < chunkHeaderSize || b[0] != 0x1e || b[1] != 0x0f {
+			parts = [][]byte{b}
+			break
+		}
+		seq, count := int(b[10]), int(b[11])
+		if parts == nil {
+			parts = make([][]byte, count)
+		}
+		parts[seq] = b[chunkHeaderSize:]
+		if seq == count-1 {
+			break
+		}
+	}
+	b := bytes.Join(parts, nil)
+	var r io.Reader
+	var err error
+	switch {
+	case b[0] == 0x1f && b[1] == 0x8b:
+		r, err = gzip.NewReader(bytes.NewReader(b))
+	case b[0] == 0x78:
+		r, err = zlib.NewReader(bytes.NewReader(b))
+	default:
+		r = bytes.NewReader(b)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decode(t, b)
+}
+
+func TestUDP(t *testing.T) {
+	assert := assert.New(t)
+	conn := handlertest.ListenUDP(t)
+	for _, compression := range []string{"gzip", "zlib", "none"} {
+		h, err := Dial(Config{Addr: conn.LocalAddr().String(), Host: "host", Compression: compression, ChunkSize: 100})
+		if !assert.NoError(err) {
+			return
+		}
+		h.Handle([]*slog.Message{{Timestamp: handlertest.Time, Level: slog.LevelInfo, Text: "short"}})
+		assert.Equal("short", readUDP(t, conn)["short_message"], compression)
+
+		// an incompressible message is sent in chunks
+		text := make([]byte, 1000)
+		for i := range text {
+			text[i] = byte('a' + (i*7919)%26)
+		}
+		h.Handle([]*slog.Message{{Timestamp: handlertest.Time, Level: slog.LevelInfo, Text: string(text)}})
+		assert.Equal(string(text), readUDP(t, conn)["short_message"], compression)
+		assert.NoError(h.Close())
+	}
+}
+
+// readNullTerminated reads a message terminated by a null byte.
+func readNullTerminated(r *bufio.Reader) (string, error) {
+	msg, err := r.ReadString(0)
+	return strings.TrimSuffix(msg, "\x00"), err
+}
+
+func TestTCP(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewTCPServer(t, readNullTerminated)
+
+	l := slog.New()
+	l.SetOutput(ioutil.Discard)
+	h, err := Dial(Config{Network: "tcp", Addr: s.Addr})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	l.AddHandler(h)
+	l.Info(context.Background(), "first message")
+	l.Error(context.Background(), "second message", slog.WithValue("a", "b"))
+
+	for _, text := range []string{"first message", "second message"} {
+		fields := decode(t, []byte(s.Next()))
+		assert.Equal(text, fields["short_message"])
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	assert := assert.New(t)
+	addr := handlertest.ListenStalled(t)
+	var c Config
+	err := json.Unmarshal([]byte(`{"network": "tcp", "addr": "`+addr+`", "timeout": "50ms"}`), &c)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(50*time.Millisecond, c.Timeout)
+	h, err := Dial(c)
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+
+	// once the socket buffers are full, sends time out and
+	// the messages are dropped
+	text := strings.Repeat("x", 1<<20)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 32; i++ {
+			h.Handle([]*slog.Message{{Timestamp: handlertest.Time, Level: slog.LevelInfo, Text: text}})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("send did not time out")
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewTCPServer(t, readNullTerminated)
+	h, err := Dial(Config{Network: "tcp", Addr: s.Addr})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+
+	// the server goes away
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	ln.Close()
+	h.conn.Close()
+	h.conn = nil
+	h.config.Addr = ln.Addr().String()
+	h.Handle(handlertest.Messages("refused"))
+	assert.Equal(int64(1), h.Dropped())
+
+	// messages are dropped without connecting until the backoff
+	// has passed, even though the server is back
+	s = handlertest.NewTCPServer(t, readNullTerminated)
+	h.config.Addr = s.Addr
+	h.Handle(handlertest.Messages("not connected"))
+	assert.Equal(int64(2), h.Dropped())
+	assert.Nil(h.conn)
+
+	h.backoff.Reset()
+	h.Handle(handlertest.Messages("reconnected"))
+	assert.Equal("reconnected", decode(t, []byte(s.Next()))["short_message"])
+	assert.Equal(int64(2), h.Dropped())
+}
+
+func TestConfigFactory(t *testing.T) {
+	assert := assert.New(t)
+	conn := handlertest.ListenUDP(t)
+	l := handlertest.ConfigLogger(t, "gelf", `{"addr": "`+conn.LocalAddr().String()+`", "host": "cfg", "compression": "zlib"}`)
+	l.Info(context.Background(), "configured")
+	fields := readUDP(t, conn)
+	assert.Equal("configured", fields["short_message"])
+	assert.Equal("cfg", fields["host"])
+
+	_, err := Dial(Config{Network: "ipx"})
+	assert.Equal(errUnknownNetwork, err)
+	_, err = Dial(Config{Compression: "lz4"})
+	assert.Equal(errUnknownCompression, err)
+	_, err = Dial(Config{ChunkSize: 12})
+	assert.Equal(errChunkSize, err)
+}
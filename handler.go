@@ -0,0 +1,218 @@
+package slog
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// HandlerRegistration is returned when a handler is added to a Logger.
+// It can be used to remove the handler.
+type HandlerRegistration struct {
+	logger *loggerImpl
+	entry  *handlerEntry
+}
+
+// Remove removes the handler from the logger. It is safe to call Remove
+// more than once, from any goroutine, and from within the handler's Handle
+// method. Remove has no effect if the handler has already been removed,
+// or if the logger's handlers have since been replaced.
+func (r *HandlerRegistration) Remove() {
+	if r != nil && r.logger != nil {
+		r.logger.removeHandler(r.entry)
+	}
+}
+
+// Handler returns the registered handler.
+func (r *HandlerRegistration) Handler() Handler {
+	return r.entry.handler
+}
+
+// handlerEntry is a handler together with the range of levels it receives.
+type handlerEntry struct {
+	handler  Handler
+	minLevel Level // zero for no minimum
+	maxLevel Level // zero for no maximum
+}
+
+// handlerList is a list of handlers that is never modified in place.
+// Adding or removing a handler returns a new list, so a copy of the list
+// can be iterated over safely while other goroutines modify the logger.
+type handlerList []*handlerEntry
+
+func (list handlerList) add(e *handlerEntry) handlerList {
+	newList := make(handlerList, len(list), len(list)+1)
+	copy(newList, list)
+	return append(newList, e)
+}
+
+func (list handlerList) remove(e *handlerEntry) handlerList {
+	for i := range list {
+		if list[i] == e {
+			newList := make(handlerList, 0, len(list)-1)
+			newList = append(newList, list[:i]...)
+			return append(newList, list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// HandlerFunc is an adapter that allows an ordinary function
+// to be used as a Handler.
+type HandlerFunc func(msgs []*Message)
+
+// Handle calls f(msgs).
+func (f HandlerFunc) Handle(msgs []*Message) {
+	f(msgs)
+}
+
+// Filter returns a handler that passes to h only those messages for which
+// pred returns true. If no messages in a batch pass, h is not called.
+func Filter(h Handler, pred func(m *Message) bool) Handler {
+	return &filterHandler{handler: h, pred: pred}
+}
+
+// LevelFilter returns a handler that passes to h only those messages with
+// levels between minLevel and maxLevel inclusive. A zero minLevel or
+// maxLevel means no minimum or maximum respectively.
+func LevelFilter(h Handler, minLevel, maxLevel Level) Handler {
+	return Filter(h, func(m *Message) bool {
+		return inLevelRange(m.Level, minLevel, maxLevel)
+	})
+}
+
+type filterHandler struct {
+	handler Handler
+	pred    func(m *Message) bool
+}
+
+func (f *filterHandler) Handle(msgs []*Message) {
+	var filtered []*Message
+	for _, m := range msgs {
+		if f.pred(m) {
+			filtered = append(filtered, m)
+		}
+	}
+	if len(filtered) > 0 {
+		f.handler.Handle(filtered)
+	}
+}
+
+func (f *filterHandler) Flush() error {
+	return flushHandler(f.handler)
+}
+
+// Map returns a handler that passes to h the result of calling fn for each
+// message. If fn returns nil, the message is dropped. The same message is
+// passed to all of a logger's handlers, so fn must not modify the message
+// it receives: it should modify and return a copy made with Message.Clone.
+func Map(h Handler, fn func(m *Message) *Message) Handler {
+	return &mapHandler{handler: h, fn: fn}
+}
+
+type mapHandler struct {
+	handler Handler
+	fn      func(m *Message) *Message
+}
+
+func (f *mapHandler) Handle(msgs []*Message) {
+	mapped := make([]*Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m = f.fn(m); m != nil {
+			mapped = append(mapped, m)
+		}
+	}
+	if len(mapped) > 0 {
+		f.handler.Handle(mapped)
+	}
+}
+
+func (f *mapHandler) Flush() error {
+	return flushHandler(f.handler)
+}
+
+// Tee returns a handler that passes each batch of messages to
+// all of the handlers in turn.
+func Tee(handlers ...Handler) Handler {
+	return teeHandler(append([]Handler(nil), handlers...))
+}
+
+type teeHandler []Handler
+
+func (t teeHandler) Handle(msgs []*Message) {
+	for _, h := range t {
+		h.Handle(msgs)
+	}
+}
+
+func (t teeHandler) Flush() error {
+	var firstErr error
+	for _, h := range t {
+		if err := flushHandler(h); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Isolate returns a handler that recovers from any panic in h, so that a
+// faulty handler cannot crash the program that is logging a message. The
+// panic value and stack trace are passed to report. If report is nil,
+// the panic is reported to stderr. If h panics while it is being flushed,
+// Flush returns an error describing the panic.
+func Isolate(h Handler, report func(p interface{}, stack []byte)) Handler {
+	if report == nil {
+		report = reportPanic
+	}
+	return &isolateHandler{handler: h, report: report}
+}
+
+type isolateHandler struct {
+	handler Handler
+	report  func(p interface{}, stack []byte)
+}
+
+func (f *isolateHandler) Handle(msgs []*Message) {
+	defer f.recover(nil)
+	f.handler.Handle(msgs)
+}
+
+func (f *isolateHandler) Flush() (err error) {
+	defer f.recover(&err)
+	return flushHandler(f.handler)
+}
+
+// recover reports a panic in the handler. If err is not nil,
+// it is set to an error describing the panic.
+func (f *isolateHandler) recover(err *error) {
+	if p := recover(); p != nil {
+		f.report(p, debug.Stack())
+		if err != nil {
+			*err = fmt.Errorf("handler panic: %v", p)
+		}
+	}
+}
+
+// reportPanic writes details of a handler panic to stderr. It does not
+// log to a Logger, as that could cause the panic to recur.
+func reportPanic(p interface{}, stack []byte) {
+	m := &Message{
+		Timestamp: time.Now(),
+		Level:     LevelError,
+		Text:      "handler panic",
+		Properties: []Property{
+			{"panic", fmt.Sprint(p)},
+			{"stack", string(stack)},
+		},
+	}
+	LogfmtFormatter{}.Format(os.Stderr, m)
+}
+
+// flushHandler flushes h if it implements Flusher.
+func flushHandler(h Handler) error {
+	if f, ok := h.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package slog
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+)
+
+func TestHandlerRegistration(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(nil)
+	ctx := context.Background()
+	th1 := &testHandler{}
+	th2 := &testHandler{}
+	reg1 := l.AddHandler(th1)
+	reg2 := l.AddHandler(th2)
+	reg3 := l.AddLevelHandler(th1, LevelError, 0)
+	assert.Exactly(th1, reg1.Handler())
+
+	l.Error(ctx, "error message")
+	assert.Equal(2, len(th1.Messages))
+	assert.Equal(1, len(th2.Messages))
+
+	// removing one registration leaves the other registration of the same handler
+	reg1.Remove()
+	reg1.Remove()
+	l.Error(ctx, "error message")
+	assert.Equal(3, len(th1.Messages))
+	assert.Equal(2, len(th2.Messages))
+
+	reg2.Remove()
+	reg3.Remove()
+	l.Error(ctx, "error message")
+	assert.Equal(3, len(th1.Messages))
+	assert.Equal(2, len(th2.Messages))
+
+	var nilReg *HandlerRegistration
+	nilReg.Remove()
+}
+
+func TestReplaceHandlers(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	SetOutput(nil)
+	ctx := context.Background()
+	th1 := &testHandler{}
+	th2 := &testHandler{}
+	reg := AddHandler(th1)
+
+	ReplaceHandlers(th2)
+	Info(ctx, "info message")
+	assert.Equal(0, len(th1.Messages))
+	assert.Equal(1, len(th2.Messages))
+
+	// stale registration has no effect
+	reg.Remove()
+	Info(ctx, "info message")
+	assert.Equal(2, len(th2.Messages))
+
+	ReplaceHandlers()
+	Info(ctx, "info message")
+	assert.Equal(2, len(th2.Messages))
+}
+
+// oneShotHandler removes itself after handling the first message.
+type oneShotHandler struct {
+	reg   *HandlerRegistration
+	count int
+}
+
+func (h *oneShotHandler) Handle(msgs []*Message) {
+	h.count++
+	h.reg.Remove()
+}
+
+func TestRemoveHandlerFromHandle(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(nil)
+	ctx := context.Background()
+	h := &oneShotHandler{}
+	h.reg = l.AddHandler(h)
+
+	l.Info(ctx, "info message")
+	l.Info(ctx, "info message")
+	assert.Equal(1, h.count)
+}
+
+type countHandler struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (h *countHandler) Handle(msgs []*Message) {
+	h.mu.Lock()
+	h.count += len(msgs)
+	h.mu.Unlock()
+}
+
+func TestHandlersConcurrentModification(t *testing.T) {
+	l := New()
+	l.SetOutput(nil)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.AddHandler(&countHandler{}).Remove()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Info(ctx, "info message")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHandlerFunc(t *testing.T) {
+	assert := assert.New(t)
+	var count int
+	h := HandlerFunc(func(msgs []*Message) { count += len(msgs) })
+	h.Handle([]*Message{{}, {}})
+	assert.Equal(2, count)
+}
+
+func TestFilter(t *testing.T) {
+	assert := assert.New(t)
+	th := &testHandler{}
+	h := Filter(th, func(m *Message) bool { return m.Code() == "X" })
+	h.Handle([]*Message{{code: "X"}, {code: "Y"}, {code: "X"}})
+	assert.Equal(2, len(th.Messages))
+	h.Handle([]*Message{{code: "Y"}})
+	assert.Equal(2, len(th.Messages))
+	assert.NoError(h.(Flusher).Flush())
+	assert.Equal(1, th.Flushed)
+
+	th = &testHandler{}
+	h = LevelFilter(th, LevelInfo, LevelWarning)
+	h.Handle([]*Message{{Level: LevelDebug}, {Level: LevelInfo}, {Level: LevelWarning}, {Level: LevelError}})
+	assert.Equal(2, len(th.Messages))
+}
+
+func TestMap(t *testing.T) {
+	assert := assert.New(t)
+	th := &testHandler{}
+	h := Map(th, func(m *Message) *Message {
+		if m.Level < LevelInfo {
+			return nil
+		}
+		m = m.Clone()
+		m.Properties = append(m.Properties, Property{"mapped", true})
+		return m
+	})
+	original := &Message{Level: LevelInfo, Properties: []Property{{"a", 1}}}
+	h.Handle([]*Message{{Level: LevelDebug}, original})
+	assert.Equal(1, len(th.Messages))
+	assert.Equal([]Property{{"a", 1}, {"mapped", true}}, th.Messages[0].Properties)
+	assert.Equal([]Property{{"a", 1}}, original.Properties)
+}
+
+func TestTee(t *testing.T) {
+	assert := assert.New(t)
+	th1 := &testHandler{}
+	th2 := &testHandler{}
+	h := Tee(th1, th2)
+	h.Handle([]*Message{{}})
+	assert.Equal(1, len(th1.Messages))
+	assert.Equal(1, len(th2.Messages))
+	assert.NoError(h.(Flusher).Flush())
+	assert.Equal(1, th1.Flushed)
+	assert.Equal(1, th2.Flushed)
+}
+
+func TestIsolate(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(nil)
+	ctx := context.Background()
+
+	var reported interface{}
+	var stack []byte
+	l.AddHandler(Isolate(HandlerFunc(func(msgs []*Message) {
+		panic("handler failed")
+	}), func(p interface{}, s []byte) {
+		reported = p
+		stack = s
+	}))
+	th := &testHandler{}
+	l.AddHandler(th)
+
+	assert.NotPanics(func() { l.Error(ctx, "error message") })
+	assert.Equal("handler failed", reported)
+	assert.NotEmpty(stack)
+	assert.Equal(1, len(th.Messages))
+
+	// logger is still usable after the panic
+	l.Error(ctx, "error message")
+	assert.Equal(2, len(th.Messages))
+
+	// a panic while flushing is returned as an error
+	reported = nil
+	h := Isolate(&panicFlusher{}, func(p interface{}, s []byte) { reported = p })
+	err := flushHandler(h)
+	assert.EqualError(err, "handler panic: flush failed")
+	assert.Equal("flush failed", reported)
+}
+
+// panicFlusher is a handler that panics when it is flushed.
+type panicFlusher struct{ testHandler }
+
+func (*panicFlusher) Flush() error {
+	panic("flush failed")
+}
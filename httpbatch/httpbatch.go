@@ -0,0 +1,422 @@
+// Package httpbatch provides a slog handler that sends messages in batches
+// to an HTTP endpoint, for log collectors that accept messages in a
+// POST request body.
+//
+//	h, err := httpbatch.New(httpbatch.Config{
+//		URL:      "https://logs.example.com/ingest",
+//		Encoding: httpbatch.EncodingJSONLines,
+//		Gzip:     true,
+//		Headers:  map[string]string{"Authorization": "Bearer " + token},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer h.Close()
+//	slog.AddHandler(h)
+//
+// The package registers the "httpbatch" handler type for use in a
+// slog.Config, with a Config in JSON format as its parameters. Durations
+// in the parameters are strings such as "5s".
+//
+// If a spool directory is configured, batches that cannot be delivered
+// because the endpoint is unavailable are kept in a spool (see package
+// github.com/spkg/slog/spool), and sent in order when delivery resumes,
+// including after the process restarts.
+package httpbatch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/batch"
+	"github.com/spkg/slog/internal/jsonconfig"
+	"github.com/spkg/slog/spool"
+)
+
+// Encodings of the request body.
+const (
+	EncodingJSONLines = "jsonl"  // One JSON object per line
+	EncodingLogfmt    = "logfmt" // One logfmt message per line
+	EncodingJSON      = "json"   // A JSON array of objects
+)
+
+// Policies for messages that arrive when the queue is full.
+const (
+	DropOldest = "oldest" // Discard the oldest queued message
+	DropNewest = "newest" // Discard the arriving message
+)
+
+// Defaults for the configuration.
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = batch.DefaultFlushInterval
+	DefaultQueueSize     = batch.DefaultQueueSize
+	DefaultMaxRetries    = 5
+	DefaultMinBackoff    = batch.DefaultMinBackoff
+	DefaultMaxBackoff    = batch.DefaultMaxBackoff
+	DefaultFlushTimeout  = batch.DefaultFlushTimeout
+	DefaultTimeout       = 10 * time.Second
+)
+
+var (
+	errNoURL           = errors.New("httpbatch: no URL")
+	errUnknownEncoding = errors.New("httpbatch: unknown encoding")
+	errUnknownPolicy   = errors.New("httpbatch: unknown drop policy")
+	errBadRecord       = errors.New("httpbatch: invalid spool record")
+)
+
+// contentTypes maps each encoding to the Content-Type of requests.
+var contentTypes = map[string]string{
+	EncodingJSONLines: "application/x-ndjson",
+	EncodingLogfmt:    "text/plain; charset=utf-8",
+	EncodingJSON:      "application/json",
+}
+
+// Config describes the endpoint, the format of requests, and how failed
+// requests are retried. Zero values are replaced by the defaults.
+type Config struct {
+	URL           string            `json:"url"`
+	Encoding      string            `json:"encoding,omitempty"`       // EncodingJSONLines (default), EncodingLogfmt or EncodingJSON
+	Gzip          bool              `json:"gzip,omitempty"`           // Compress request bodies
+	Headers       map[string]string `json:"headers,omitempty"`        // Added to each request
+	BatchSize     int               `json:"batch_size,omitempty"`     // Maximum messages per request
+	FlushInterval time.Duration     `json:"flush_interval,omitempty"` // Maximum time a message waits before it is sent
+	QueueSize     int               `json:"queue_size,omitempty"`     // Maximum messages waiting to be sent
+	DropPolicy    string            `json:"drop_policy,omitempty"`    // DropOldest (default) or DropNewest
+	MaxRetries    int               `json:"max_retries,omitempty"`    // Retries of a failed request; negative for none
+	MinBackoff    time.Duration     `json:"min_backoff,omitempty"`    // Delay before the first retry
+	MaxBackoff    time.Duration     `json:"max_backoff,omitempty"`    // Maximum delay between retries
+	FlushTimeout  time.Duration     `json:"flush_timeout,omitempty"`  // Maximum time Flush and Close wait for batches to be sent
+	Timeout       time.Duration     `json:"timeout,omitempty"`        // Timeout of each request
+	SpoolDir      string            `json:"spool_dir,omitempty"`      // Directory for undelivered batches, none if empty
+	SpoolSize     int64             `json:"spool_size,omitempty"`     // Maximum size of the spool in bytes, default 256MB
+
+	// Client sends the requests. If nil, a client with
+	// the configured timeout is used.
+	Client *http.Client `json:"-"`
+
+	// OnError, if not nil, is called with the error when a batch
+	// is discarded because it could not be sent. It is called from a
+	// separate goroutine, and may log the error to a logger that uses
+	// the handler, but must not close the handler.
+	OnError func(error) `json:"-"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface,
+// parsing durations with time.ParseDuration.
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type config Config
+	return jsonconfig.Unmarshal(b, (*config)(c), "flush_interval", "min_backoff", "max_backoff", "flush_timeout", "timeout")
+}
+
+// StatusError is the error for a request that failed
+// with an unsuccessful HTTP status.
+type StatusError = batch.StatusError
+
+// Handler is a slog.Handler that queues messages and sends them in batches.
+//
+// A batch is sent when it reaches the batch size, or when the flush interval
+// has passed. Requests that fail because of a network error or a 5xx or 429
+// status are retried with exponential backoff and jitter. A delay given by
+// the Retry-After header of the response is honored, up to the maximum
+// backoff. Batches that cannot be sent are discarded, or kept in the spool
+// if the error may be temporary and a spool directory is configured. Once a
+// batch is spooled, later batches are spooled too, so that they are sent in
+// order.
+//
+// When the queue is full, messages are dropped according to the drop policy.
+// A Handler is safe for concurrent use.
+type Handler struct {
+	config  Config
+	queue   *batch.Queue
+	spool   *spool.Spool // nil if not configured
+	spilled bool         // batches are being spooled, used by the queue's goroutine
+}
+
+func init() {
+	slog.RegisterHandlerFactory("httpbatch", func(params json.RawMessage) (slog.Handler, error) {
+		var c Config
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &c); err != nil {
+				return nil, err
+			}
+		}
+		return New(c)
+	})
+}
+
+// New returns a handler that sends messages to the endpoint described by
+// the configuration. It starts a goroutine that sends the batches, which
+// stops when the handler is closed.
+func New(c Config) (*Handler, error) {
+	if c.URL == "" {
+		return nil, errNoURL
+	}
+	if c.Encoding == "" {
+		c.Encoding = EncodingJSONLines
+	}
+	if contentTypes[c.Encoding] == "" {
+		return nil, errUnknownEncoding
+	}
+	switch c.DropPolicy {
+	case "":
+		c.DropPolicy = DropOldest
+	case DropOldest, DropNewest:
+	default:
+		return nil, errUnknownPolicy
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = DefaultMaxRetries
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: c.Timeout}
+	}
+	h := &Handler{config: c}
+	opts := batch.Options{
+		Name:          "httpbatch",
+		BatchSize:     c.BatchSize,
+		FlushInterval: c.FlushInterval,
+		QueueSize:     c.QueueSize,
+		DropNewest:    c.DropPolicy == DropNewest,
+		MaxRetries:    c.MaxRetries,
+		MinBackoff:    c.MinBackoff,
+		MaxBackoff:    c.MaxBackoff,
+		FlushTimeout:  c.FlushTimeout,
+		Send:          h.send,
+		OnError:       c.OnError,
+	}
+	if c.SpoolDir != "" {
+		var err error
+		if h.spool, err = spool.Open(c.SpoolDir, spool.Options{MaxSize: c.SpoolSize}); err != nil {
+			return nil, err
+		}
+		opts.Begin = h.sendSpooled
+	}
+	h.queue = batch.New(opts)
+	return h, nil
+}
+
+// Handle implements the slog.Handler interface.
+func (h *Handler) Handle(msgs []*slog.Message) {
+	h.queue.Handle(msgs)
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (h *Handler) Dropped() int64 {
+	return h.queue.Dropped()
+}
+
+// Flush implements the slog.Flusher interface. It sends all queued messages
+// and returns the error of the last batch that could not be sent since the
+// previous flush, if any. If the batches have not been sent within the flush
+// timeout, Flush returns an error while they continue to be sent.
+func (h *Handler) Flush() error {
+	return h.queue.Flush()
+}
+
+// Close sends all queued messages and stops the handler. Messages
+// handled after Close are discarded. If the messages have not been sent
+// within the flush timeout, failed requests are not retried, and the
+// messages still queued are discarded. Batches in the spool remain there
+// until the handler is next created with the same spool directory.
+func (h *Handler) Close() error {
+	err := h.queue.Close()
+	if h.spool != nil {
+		if serr := h.spool.Close(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// send sends a batch, or adds it to the spool if batches are being
+// spooled, or if it could not be sent because of an error that may
+// be temporary.
+func (h *Handler) send(msgs []*slog.Message) error {
+	b, err := h.encode(msgs)
+	if err != nil {
+		h.queue.Discard(err)
+		return err
+	}
+	var lastErr error
+	if !h.spilled {
+		temporary, err := h.deliver(b)
+		if err == nil {
+			return nil
+		}
+		if !temporary || h.spool == nil {
+			h.queue.Discard(err)
+			return err
+		}
+		lastErr = err
+		h.spilled = true
+	}
+	if err := h.spool.Append(b.record()); err != nil {
+		h.queue.Discard(err)
+		return err
+	}
+	return lastErr
+}
+
+// sendSpooled sends the batches in the spool, in order, before the
+// queued messages. It stops at the first batch that fails with an error
+// that may be temporary, which is left in the spool and returned, and
+// the queued messages are spooled after it.
+func (h *Handler) sendSpooled() error {
+	h.spilled = true
+	for {
+		record, err := h.spool.Peek()
+		if err == io.EOF {
+			h.spilled = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b, err := parseRecord(record)
+		if err == nil {
+			var temporary bool
+			if temporary, err = h.deliver(b); temporary {
+				return err
+			}
+		}
+		if err != nil {
+			h.queue.Discard(err)
+		}
+		if err := h.spool.Commit(); err != nil {
+			return err
+		}
+	}
+}
+
+// deliver posts a batch, retrying if the request fails with an error
+// that may be temporary. If the batch could not be delivered, it returns
+// the error and whether it may be temporary.
+func (h *Handler) deliver(b body) (temporary bool, err error) {
+	return h.queue.Retry(func() (time.Duration, error) {
+		return h.post(b)
+	})
+}
+
+// post sends a request with the body. If the request fails and can be
+// retried, it returns the delay requested by the server, which is zero
+// if none was given. If the request cannot be retried, the delay is negative.
+func (h *Handler) post(b body) (time.Duration, error) {
+	req, err := http.NewRequest("POST", h.config.URL, bytes.NewReader(b.data))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", contentTypes[b.encoding])
+	if b.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range h.config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.config.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	wait, err := h.queue.CheckStatus(resp)
+	io.Copy(ioutil.Discard, resp.Body)
+	return wait, err
+}
+
+// body is an encoded batch of messages.
+type body struct {
+	encoding string
+	gzip     bool
+	data     []byte
+}
+
+// record returns the body as a spool record, containing the length of
+// the encoding name, the encoding name, a gzip flag, and the data. The
+// encoding is stored so that spooled batches are sent correctly if the
+// configuration changes.
+func (b body) record() []byte {
+	r := make([]byte, 0, 2+len(b.encoding)+len(b.data))
+	r = append(r, byte(len(b.encoding)))
+	r = append(r, b.encoding...)
+	if b.gzip {
+		r = append(r, 1)
+	} else {
+		r = append(r, 0)
+	}
+	return append(r, b.data...)
+}
+
+// parseRecord returns the body stored in a spool record.
+func parseRecord(r []byte) (body, error) {
+	if len(r) < 2 || len(r) < 2+int(r[0]) {
+		return body{}, errBadRecord
+	}
+	n := int(r[0])
+	b := body{encoding: string(r[1 : 1+n]), gzip: r[1+n] != 0, data: r[2+n:]}
+	if contentTypes[b.encoding] == "" {
+		return body{}, errBadRecord
+	}
+	return b, nil
+}
+
+// encode returns the request body for a batch.
+func (h *Handler) encode(batch []*slog.Message) (body, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if h.config.Gzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	if err := Encode(w, h.config.Encoding, batch); err != nil {
+		return body{}, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return body{}, err
+		}
+	}
+	return body{encoding: h.config.Encoding, gzip: h.config.Gzip, data: buf.Bytes()}, nil
+}
+
+// Encode writes a batch of messages to w in the named encoding.
+func Encode(w io.Writer, encoding string, batch []*slog.Message) error {
+	var buf bytes.Buffer
+	switch encoding {
+	case EncodingJSONLines:
+		for _, m := range batch {
+			slog.JSONFormatter{}.Format(&buf, m)
+		}
+	case EncodingLogfmt:
+		for _, m := range batch {
+			slog.LogfmtFormatter{}.Format(&buf, m)
+		}
+	case EncodingJSON:
+		buf.WriteByte('[')
+		for i, m := range batch {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			slog.JSONFormatter{}.Format(&buf, m)
+			buf.Truncate(buf.Len() - 1) // new line
+		}
+		buf.WriteByte(']')
+	default:
+		return errUnknownEncoding
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
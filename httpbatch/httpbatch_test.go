@@ -0,0 +1,340 @@
+package httpbatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/handlertest"
+)
+
+func TestEncode(t *testing.T) {
+	assert := assert.New(t)
+	msgs := handlertest.Messages("one", "two")
+	var buf bytes.Buffer
+	assert.NoError(Encode(&buf, EncodingJSONLines, msgs))
+	assert.Equal(`{"time":"2020-01-02T03:04:05.678901Z","level":"info","msg":"one"}`+"\n"+
+		`{"time":"2020-01-02T03:04:05.678901Z","level":"info","msg":"two"}`+"\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(Encode(&buf, EncodingJSON, msgs))
+	var objects []map[string]interface{}
+	if assert.NoError(json.Unmarshal(buf.Bytes(), &objects)) {
+		assert.Len(objects, 2)
+		assert.Equal("two", objects[1]["msg"])
+	}
+
+	buf.Reset()
+	assert.NoError(Encode(&buf, EncodingLogfmt, msgs))
+	assert.Equal(2, strings.Count(buf.String(), "\n"))
+	assert.Contains(buf.String(), "msg=two\n")
+
+	assert.Equal(errUnknownEncoding, Encode(&buf, "xml", msgs))
+}
+
+func TestBatches(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewServer(t)
+	h, err := New(Config{
+		URL:           s.URL,
+		Gzip:          true,
+		Headers:       map[string]string{"Authorization": "Bearer token"},
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	h.Handle(handlertest.Messages("one", "two", "three"))
+	assert.NoError(h.Flush())
+	assert.NoError(h.Close())
+
+	bodies := s.Bodies()
+	if assert.Len(bodies, 2) {
+		assert.Equal(2, strings.Count(bodies[0], "\n"))
+		assert.Contains(bodies[0], `"msg":"one"`)
+		assert.Contains(bodies[1], `"msg":"three"`)
+		r := s.Requests()[0]
+		assert.Equal("Bearer token", r.Header.Get("Authorization"))
+		assert.Equal("application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.Equal("gzip", r.Header.Get("Content-Encoding"))
+	}
+
+	// messages are discarded after Close
+	h.Handle(handlertest.Messages("four"))
+	assert.EqualError(h.Flush(), "httpbatch: handler closed")
+	assert.NoError(h.Close())
+	assert.Len(s.Bodies(), 2)
+}
+
+func TestFlushInterval(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewServer(t)
+	h, err := New(Config{URL: s.URL, Encoding: EncodingLogfmt, FlushInterval: 10 * time.Millisecond})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	l := slog.New()
+	l.SetOutput(ioutil.Discard)
+	l.AddHandler(h)
+	l.Info(context.Background(), "waiting")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Bodies()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if bodies := s.Bodies(); assert.Len(bodies, 1) {
+		assert.Contains(bodies[0], "msg=waiting")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	h, err := New(Config{URL: s.URL, FlushInterval: time.Hour, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	h.Handle(handlertest.Messages("retried"))
+	assert.NoError(h.Flush())
+	bodies := s.Bodies()
+	if assert.Len(bodies, 3) {
+		assert.Equal(bodies[0], bodies[2])
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewServer(t, http.StatusBadRequest, http.StatusInternalServerError, http.StatusInternalServerError)
+	var errs []error
+	h, err := New(Config{
+		URL:           s.URL,
+		FlushInterval: time.Hour,
+		MaxRetries:    1,
+		MinBackoff:    time.Millisecond,
+		OnError:       func(err error) { errs = append(errs, err) },
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+
+	// client errors are not retried
+	h.Handle(handlertest.Messages("bad"))
+	err = h.Flush()
+	if assert.IsType(&StatusError{}, err) {
+		assert.Equal(http.StatusBadRequest, err.(*StatusError).StatusCode)
+	}
+	assert.Len(s.Bodies(), 1)
+
+	// retries are limited
+	h.Handle(handlertest.Messages("failed"))
+	assert.Error(h.Flush())
+	assert.Len(s.Bodies(), 3)
+
+	// errors are reported by the time the handler is closed
+	assert.NoError(h.Close())
+	assert.Len(errs, 2)
+}
+
+func TestOnErrorLogs(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewServer(t, http.StatusBadRequest)
+	l := slog.New()
+	l.SetOutput(ioutil.Discard)
+	ctx := context.Background()
+	reported := make(chan struct{})
+	var h *Handler
+	h, err := New(Config{
+		URL:           s.URL,
+		FlushInterval: time.Hour,
+		OnError: func(err error) {
+			// logging the error and flushing the handler does not deadlock
+			l.Error(ctx, "cannot send batch", slog.WithError(err))
+			h.Flush()
+			close(reported)
+		},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	l.AddHandler(h)
+	l.Info(ctx, "rejected")
+	assert.Error(l.Flush())
+	select {
+	case <-reported:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnError did not return")
+	}
+	if bodies := s.Bodies(); assert.Len(bodies, 2) {
+		assert.Contains(bodies[0], `"msg":"rejected"`)
+		assert.Contains(bodies[1], `"msg":"cannot send batch"`)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewServer(t, http.StatusTooManyRequests)
+	s.SetHeader("Retry-After", "1")
+	h, err := New(Config{URL: s.URL, FlushInterval: time.Hour, MinBackoff: time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	h.Handle(handlertest.Messages("limited"))
+	start := time.Now()
+	assert.NoError(h.Flush())
+	elapsed := time.Since(start)
+	// the delay is limited to the maximum backoff
+	assert.True(elapsed >= 50*time.Millisecond && elapsed < time.Second, elapsed)
+}
+
+func TestDropPolicy(t *testing.T) {
+	assert := assert.New(t)
+	for _, policy := range []string{DropOldest, DropNewest} {
+		s := handlertest.NewServer(t)
+		h, err := New(Config{URL: s.URL, Encoding: EncodingJSON, QueueSize: 2, BatchSize: 10, FlushInterval: time.Hour, DropPolicy: policy})
+		if !assert.NoError(err) {
+			return
+		}
+		h.Handle(handlertest.Messages("one", "two", "three"))
+		assert.Equal(int64(1), h.Dropped())
+		assert.NoError(h.Close())
+
+		var objects []map[string]interface{}
+		if bodies := s.Bodies(); assert.Len(bodies, 1) && assert.NoError(json.Unmarshal([]byte(bodies[0]), &objects)) {
+			var texts []string
+			for _, o := range objects {
+				texts = append(texts, o["msg"].(string))
+			}
+			if policy == DropOldest {
+				assert.Equal([]string{"two", "three"}, texts)
+			} else {
+				assert.Equal([]string{"one", "two"}, texts)
+			}
+		}
+	}
+}
+
+func TestConfigFactory(t *testing.T) {
+	assert := assert.New(t)
+	var c Config
+	err := json.Unmarshal([]byte(`{"url": "http://localhost/", "flush_interval": "5s", "max_backoff": "1m", "batch_size": 10}`), &c)
+	if assert.NoError(err) {
+		assert.Equal(Config{URL: "http://localhost/", FlushInterval: 5 * time.Second, MaxBackoff: time.Minute, BatchSize: 10}, c)
+	}
+	assert.Error(json.Unmarshal([]byte(`{"timeout": "soon"}`), &c))
+
+	s := handlertest.NewServer(t)
+	l := handlertest.ConfigLogger(t, "httpbatch", `{"url": "`+s.URL+`", "encoding": "logfmt", "flush_interval": "1h"}`)
+	l.Info(context.Background(), "configured")
+	assert.NoError(l.Flush())
+	if bodies := s.Bodies(); assert.Len(bodies, 1) {
+		assert.Contains(bodies[0], "msg=configured")
+	}
+
+	_, err = New(Config{})
+	assert.Equal(errNoURL, err)
+	_, err = New(Config{URL: s.URL, Encoding: "xml"})
+	assert.Equal(errUnknownEncoding, err)
+	_, err = New(Config{URL: s.URL, DropPolicy: "random"})
+	assert.Equal(errUnknownPolicy, err)
+}
+
+func TestSpool(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "httpbatch")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	s := handlertest.NewServer(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	var errs []error
+	h, err := New(Config{
+		URL:           s.URL,
+		FlushInterval: time.Hour,
+		MaxRetries:    -1,
+		SpoolDir:      dir,
+		OnError:       func(err error) { errs = append(errs, err) },
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	h.Handle(handlertest.Messages("one"))
+	assert.Error(h.Flush())
+	// the spooled batch fails again when the handler is closed
+	assert.Error(h.Close())
+	assert.Empty(errs)
+
+	// after a restart, spooled batches are sent first, in their
+	// original encoding
+	h, err = New(Config{URL: s.URL, FlushInterval: time.Hour, Encoding: EncodingLogfmt, Gzip: true, SpoolDir: dir})
+	if !assert.NoError(err) {
+		return
+	}
+	h.Handle(handlertest.Messages("two"))
+	assert.NoError(h.Flush())
+	assert.NoError(h.Close())
+
+	if requests := s.Requests(); assert.Len(requests, 4) {
+		assert.Equal(requests[0].Body, requests[2].Body)
+		assert.Contains(string(requests[2].Body), `"msg":"one"`)
+		assert.Equal("application/x-ndjson", requests[2].Header.Get("Content-Type"))
+		assert.Equal("", requests[2].Header.Get("Content-Encoding"))
+		assert.Contains(string(requests[3].Body), "msg=two")
+		assert.Equal("gzip", requests[3].Header.Get("Content-Encoding"))
+	}
+}
+
+func TestSpoolOrder(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "httpbatch")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	s := handlertest.NewServer(t, http.StatusServiceUnavailable)
+	h, err := New(Config{URL: s.URL, BatchSize: 1, FlushInterval: time.Hour, MaxRetries: -1, SpoolDir: dir})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	// once the first batch is spooled, the second is spooled after it,
+	// and both are sent before the third
+	h.Handle(handlertest.Messages("one", "two"))
+	h.Flush()
+	h.Handle(handlertest.Messages("three"))
+	assert.NoError(h.Flush())
+	bodies := s.Bodies()
+	if assert.Len(bodies, 4) {
+		for i, text := range []string{"one", "one", "two", "three"} {
+			assert.Contains(bodies[i], `"msg":"`+text+`"`)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	assert := assert.New(t)
+	b := body{encoding: EncodingJSON, gzip: true, data: []byte("[]")}
+	parsed, err := parseRecord(b.record())
+	assert.NoError(err)
+	assert.Equal(b, parsed)
+
+	for _, r := range []string{"", "\x05json", "\x03xml\x00<a/>"} {
+		_, err := parseRecord([]byte(r))
+		assert.Equal(errBadRecord, err, r)
+	}
+}
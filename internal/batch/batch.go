@@ -0,0 +1,464 @@
+// Package batch implements the queue, batching and retries shared by the
+// handlers that send messages to an HTTP endpoint in batches.
+package batch
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spkg/slog"
+)
+
+// Defaults for the options.
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultQueueSize     = 10000
+	DefaultMinBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff    = 30 * time.Second
+	DefaultFlushTimeout  = 10 * time.Second
+)
+
+// maxErrorBody is the maximum length of the body in a StatusError.
+const maxErrorBody = 1024
+
+// maxPending is the maximum number of errors waiting to be reported.
+const maxPending = 100
+
+// Options describe how messages are queued and batches are sent.
+// Zero values are replaced by the defaults.
+type Options struct {
+	Name          string        // Package name, the prefix of error messages
+	BatchSize     int           // Maximum messages per batch
+	FlushInterval time.Duration // Maximum time a message waits before it is sent
+	QueueSize     int           // Maximum messages waiting to be sent
+	DropNewest    bool          // Discard arriving messages instead of the oldest when the queue is full
+	Concurrency   int           // Maximum batches sent at once, default 1
+	MaxRetries    int           // Retries of a failed request; negative for none
+	MinBackoff    time.Duration // Delay before the first retry
+	MaxBackoff    time.Duration // Maximum delay between retries
+	FlushTimeout  time.Duration // Maximum time Flush and Close wait for batches to be sent
+
+	// Send sends a batch, and returns an error if it could not be sent.
+	// Unless the concurrency is greater than one, it is not called again
+	// until it has returned.
+	Send func(batch []*slog.Message) error
+
+	// Begin, if not nil, is called before the queued messages are sent,
+	// once earlier batches have been sent. It returns an error if the
+	// messages should not be sent yet.
+	Begin func() error
+
+	// OnError, if not nil, is called with the error when messages are
+	// discarded because they could not be sent. It is called from its own
+	// goroutine, in the order the errors occurred, so it may log the error
+	// to a logger that sends messages to the queue, and may flush the
+	// queue, but must not close it. If OnError falls behind, at most 100
+	// errors wait to be reported, and older errors are not reported.
+	OnError func(error)
+}
+
+// Queue queues messages and sends them in batches.
+//
+// A batch is sent when it reaches the batch size, or when the flush interval
+// has passed. When the queue is full, messages are dropped.
+// A Queue is safe for concurrent use.
+type Queue struct {
+	opts       Options
+	errClosed  error
+	errTimeout error
+
+	wake   chan struct{}   // a full batch is waiting
+	flushc chan chan error // flush requests
+	stop   chan struct{}   // closed by Close, interrupts retries
+	done   chan struct{}   // closed when run returns
+	sem    chan struct{}   // limits concurrent batches
+	wg     sync.WaitGroup  // batches being sent
+
+	reportc  chan struct{} // errors are waiting to be reported
+	reported chan struct{} // closed when report returns, nil if there is no OnError
+
+	mu      sync.Mutex // protects the following fields
+	queue   []*slog.Message
+	dropped int64
+	lastErr error   // last error since the last flush
+	pending []error // errors waiting to be reported to OnError
+	closed  bool
+	rand    *rand.Rand
+}
+
+// New returns a queue with the options. It starts a goroutine that
+// sends the batches, and one that reports errors if there is an OnError
+// function, which stop when the queue is closed.
+func New(opts Options) *Queue {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.FlushTimeout <= 0 {
+		opts.FlushTimeout = DefaultFlushTimeout
+	}
+	q := &Queue{
+		opts:       opts,
+		errClosed:  errors.New(opts.Name + ": handler closed"),
+		errTimeout: errors.New(opts.Name + ": flush timed out"),
+		wake:       make(chan struct{}, 1),
+		flushc:     make(chan chan error),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		sem:        make(chan struct{}, opts.Concurrency),
+		reportc:    make(chan struct{}, 1),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	go q.run()
+	if opts.OnError != nil {
+		q.reported = make(chan struct{})
+		go q.report()
+	}
+	return q
+}
+
+// Handle adds messages to the queue.
+func (q *Queue) Handle(msgs []*slog.Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	for _, m := range msgs {
+		if len(q.queue) >= q.opts.QueueSize {
+			q.dropped++
+			if q.opts.DropNewest {
+				continue
+			}
+			q.queue[0] = nil
+			q.queue = q.queue[1:]
+		}
+		q.queue = append(q.queue, m)
+	}
+	if len(q.queue) >= q.opts.BatchSize {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (q *Queue) Dropped() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Flush sends all queued messages, waits for all batches to be sent, and
+// returns the last error since the previous flush, if any. If the batches
+// have not been sent within the flush timeout, Flush returns an error
+// while they continue to be sent.
+func (q *Queue) Flush() error {
+	timer := time.NewTimer(q.opts.FlushTimeout)
+	defer timer.Stop()
+	return q.flush(timer.C)
+}
+
+// flush requests a flush, and waits for it until the timeout.
+func (q *Queue) flush(timeout <-chan time.Time) error {
+	errc := make(chan error, 1)
+	select {
+	case q.flushc <- errc:
+	case <-q.done:
+		return q.errClosed
+	case <-timeout:
+		return q.errTimeout
+	}
+	select {
+	case err := <-errc:
+		return err
+	case <-timeout:
+		return q.errTimeout
+	}
+}
+
+// Close sends all queued messages and stops the queue, once the errors
+// have been reported. Messages handled after Close are discarded. If the
+// messages have not been sent within the flush timeout, the batches being
+// sent are not retried, and the messages still queued are discarded.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	timer := time.NewTimer(q.opts.FlushTimeout)
+	err := q.flush(timer.C)
+	timer.Stop()
+	close(q.stop)
+	<-q.done
+	if q.reported != nil {
+		<-q.reported
+	}
+	return err
+}
+
+// run starts sending batches until the queue is closed.
+func (q *Queue) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.wake:
+			q.dispatch(true)
+		case <-ticker.C:
+			q.dispatch(false)
+		case errc := <-q.flushc:
+			q.dispatch(false)
+			q.wg.Wait()
+			q.mu.Lock()
+			errc <- q.lastErr
+			q.lastErr = nil
+			q.mu.Unlock()
+		case <-q.stop:
+			q.wg.Wait()
+			return
+		}
+	}
+}
+
+// dispatch starts sending the queued messages in batches, waiting while
+// the maximum number of batches are being sent. If full is true, only
+// full batches are sent.
+func (q *Queue) dispatch(full bool) {
+	if q.opts.Begin != nil {
+		q.wg.Wait()
+		if err := q.opts.Begin(); err != nil {
+			q.setErr(err)
+		}
+	}
+	for {
+		q.mu.Lock()
+		n := len(q.queue)
+		if n == 0 || (full && n < q.opts.BatchSize) {
+			q.mu.Unlock()
+			return
+		}
+		if n > q.opts.BatchSize {
+			n = q.opts.BatchSize
+		}
+		batch := make([]*slog.Message, n)
+		copy(batch, q.queue)
+		for i := range q.queue[:n] {
+			q.queue[i] = nil
+		}
+		q.queue = q.queue[n:]
+		q.mu.Unlock()
+
+		q.sem <- struct{}{}
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			defer func() { <-q.sem }()
+			if err := q.opts.Send(batch); err != nil {
+				q.setErr(err)
+			}
+		}()
+	}
+}
+
+// setErr records the error to be returned by the next flush.
+func (q *Queue) setErr(err error) {
+	q.mu.Lock()
+	q.lastErr = err
+	q.mu.Unlock()
+}
+
+// Discard reports the error for messages that were discarded. The error
+// is passed to OnError by the report goroutine, so that OnError does not
+// hold up sending, and can use the queue without deadlocking.
+func (q *Queue) Discard(err error) {
+	if q.opts.OnError == nil {
+		return
+	}
+	q.mu.Lock()
+	if len(q.pending) >= maxPending {
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+	}
+	q.pending = append(q.pending, err)
+	q.mu.Unlock()
+	select {
+	case q.reportc <- struct{}{}:
+	default:
+	}
+}
+
+// report passes errors to OnError until the queue has stopped,
+// and then reports the remaining errors.
+func (q *Queue) report() {
+	defer close(q.reported)
+	for {
+		var stopped bool
+		select {
+		case <-q.reportc:
+		case <-q.done:
+			stopped = true
+		}
+		q.mu.Lock()
+		errs := q.pending
+		q.pending = nil
+		q.mu.Unlock()
+		for _, err := range errs {
+			q.opts.OnError(err)
+		}
+		if stopped {
+			return
+		}
+	}
+}
+
+// Retry calls post until it succeeds, fails with an error that cannot be
+// retried, or the retries are exhausted. If the request fails and can be
+// retried, post returns the delay requested by the server, which is zero
+// if none was given. If it cannot be retried, the delay is negative.
+// Retry returns the last error, and whether it may be temporary. It stops
+// retrying when the queue is stopped by Close.
+func (q *Queue) Retry(post func() (time.Duration, error)) (temporary bool, err error) {
+	for attempt := 0; ; attempt++ {
+		wait, err := post()
+		if err == nil || wait < 0 {
+			return false, err
+		}
+		if attempt >= q.opts.MaxRetries || !q.Wait(attempt, wait) {
+			return true, err
+		}
+	}
+}
+
+// Wait waits before retrying after a failed attempt, for the backoff or the
+// delay requested by the server, whichever is longer, up to the maximum
+// backoff. It returns false as soon as the queue is stopped by Close, in
+// which case the request should not be retried.
+func (q *Queue) Wait(attempt int, requested time.Duration) bool {
+	wait := q.backoff(attempt)
+	if requested > wait {
+		wait = requested
+	}
+	if wait > q.opts.MaxBackoff {
+		wait = q.opts.MaxBackoff
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-q.stop:
+		return false
+	}
+}
+
+// backoff returns the delay before a retry: the minimum backoff doubled for
+// each previous attempt and limited to the maximum, of which a random amount
+// up to half is subtracted so that clients do not retry in step.
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.opts.MinBackoff
+	for i := 0; i < attempt && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.opts.MaxBackoff {
+		d = q.opts.MaxBackoff
+	}
+	q.mu.Lock()
+	jitter := time.Duration(q.rand.Int63n(int64(d/2) + 1))
+	q.mu.Unlock()
+	return d - jitter
+}
+
+// CheckStatus returns a StatusError if the response has an unsuccessful
+// status, and the delay before the request is retried, as for the post
+// function of Retry. The body of a successful response is not read.
+func (q *Queue) CheckStatus(resp *http.Response) (time.Duration, error) {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	err := &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       strings.TrimSpace(string(b)),
+		name:       q.opts.Name,
+	}
+	if !err.Temporary() {
+		return -1, err
+	}
+	return RetryAfter(resp.Header.Get("Retry-After"), time.Now()), err
+}
+
+// StatusError is the error for a request that failed
+// with an unsuccessful HTTP status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string // Start of the response body, which may describe the error
+	name       string // prefix of the message
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return e.name + ": " + e.Status
+	}
+	return e.name + ": " + e.Status + ": " + e.Body
+}
+
+// Temporary reports whether the request may succeed if it is retried,
+// which is the case for 5xx and 429 statuses.
+func (e *StatusError) Temporary() bool {
+	return TemporaryStatus(e.StatusCode)
+}
+
+// TemporaryStatus reports whether a request that failed with
+// the status code may succeed if it is retried.
+func TemporaryStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// RetryAfter returns the delay given by a Retry-After header, which
+// is either a number of seconds or an HTTP date.
+func RetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,176 @@
+package batch
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/handlertest"
+)
+
+func TestQueue(t *testing.T) {
+	assert := assert.New(t)
+	var mu sync.Mutex
+	var batches [][]string
+	failed := errors.New("failed")
+	q := New(Options{
+		Name:          "test",
+		BatchSize:     2,
+		QueueSize:     4,
+		FlushInterval: time.Hour,
+		Send: func(batch []*slog.Message) error {
+			var texts []string
+			for _, m := range batch {
+				texts = append(texts, m.Text)
+			}
+			mu.Lock()
+			batches = append(batches, texts)
+			mu.Unlock()
+			if batch[0].Text == "three" {
+				return failed
+			}
+			return nil
+		},
+	})
+	q.Handle(handlertest.Messages("zero", "one", "two", "three", "four"))
+	assert.Equal(int64(1), q.Dropped())
+	assert.Equal(failed, q.Flush())
+	mu.Lock()
+	assert.Equal([][]string{{"one", "two"}, {"three", "four"}}, batches)
+	mu.Unlock()
+
+	// the error is returned once
+	assert.NoError(q.Flush())
+	assert.NoError(q.Close())
+	assert.EqualError(q.Flush(), "test: handler closed")
+	assert.NoError(q.Close())
+}
+
+func TestRetry(t *testing.T) {
+	assert := assert.New(t)
+	q := New(Options{MaxRetries: 2, MinBackoff: time.Millisecond, Send: func([]*slog.Message) error { return nil }})
+	defer q.Close()
+	failed := errors.New("failed")
+
+	var attempts int
+	temporary, err := q.Retry(func() (time.Duration, error) {
+		attempts++
+		return 0, failed
+	})
+	assert.True(temporary)
+	assert.Equal(failed, err)
+	assert.Equal(3, attempts)
+
+	attempts = 0
+	temporary, err = q.Retry(func() (time.Duration, error) {
+		attempts++
+		return -1, failed
+	})
+	assert.False(temporary)
+	assert.Equal(failed, err)
+	assert.Equal(1, attempts)
+}
+
+func TestFlushTimeout(t *testing.T) {
+	assert := assert.New(t)
+	failed := errors.New("failed")
+	var q *Queue
+	q = New(Options{
+		Name:         "test",
+		MaxRetries:   100,
+		MinBackoff:   time.Hour,
+		MaxBackoff:   time.Hour,
+		FlushTimeout: 50 * time.Millisecond,
+		Send: func([]*slog.Message) error {
+			_, err := q.Retry(func() (time.Duration, error) { return 0, failed })
+			return err
+		},
+	})
+	q.Handle(handlertest.Messages("message"))
+
+	// flush gives up waiting for the batch, which is still being retried
+	assert.EqualError(q.Flush(), "test: flush timed out")
+
+	// close stops the retries
+	closed := make(chan error)
+	go func() { closed <- q.Close() }()
+	select {
+	case err := <-closed:
+		assert.EqualError(err, "test: flush timed out")
+	case <-time.After(5 * time.Second):
+		t.Fatal("close waited for the retries")
+	}
+}
+
+func TestPendingErrors(t *testing.T) {
+	assert := assert.New(t)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var reported []error
+	q := New(Options{
+		Send: func([]*slog.Message) error { return nil },
+		OnError: func(err error) {
+			if len(reported) == 0 {
+				close(entered)
+				<-release
+			}
+			reported = append(reported, err)
+		},
+	})
+
+	// while OnError is slow, only the latest errors wait to be reported
+	q.Discard(errors.New("0"))
+	<-entered
+	for i := 1; i <= maxPending+50; i++ {
+		q.Discard(errors.New(strconv.Itoa(i)))
+	}
+	close(release)
+	assert.NoError(q.Close())
+	if assert.Len(reported, maxPending+1) {
+		assert.EqualError(reported[0], "0")
+		assert.EqualError(reported[1], "51")
+		assert.EqualError(reported[maxPending], "150")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(time.Duration(0), RetryAfter("", now))
+	assert.Equal(120*time.Second, RetryAfter("120", now))
+	assert.Equal(time.Duration(0), RetryAfter("-1", now))
+	assert.Equal(30*time.Second, RetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(time.Duration(0), RetryAfter(now.Add(-time.Hour).Format(http.TimeFormat), now))
+	assert.Equal(time.Duration(0), RetryAfter("soon", now))
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+	q := &Queue{opts: Options{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}}
+	q.rand = rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		d := q.backoff(0)
+		assert.True(d >= 50*time.Millisecond && d <= 100*time.Millisecond, d)
+		d = q.backoff(2)
+		assert.True(d >= 200*time.Millisecond && d <= 400*time.Millisecond, d)
+		d = q.backoff(10)
+		assert.True(d >= 500*time.Millisecond && d <= time.Second, d)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	assert := assert.New(t)
+	err := &StatusError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests", name: "test"}
+	assert.Equal("test: 429 Too Many Requests", err.Error())
+	assert.True(err.Temporary())
+	err = &StatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request", Body: "invalid", name: "test"}
+	assert.Equal("test: 400 Bad Request: invalid", err.Error())
+	assert.False(err.Temporary())
+}
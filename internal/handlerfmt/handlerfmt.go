@@ -0,0 +1,52 @@
+// Package handlerfmt formats the levels and property values of messages
+// for the handlers that send them to other systems.
+package handlerfmt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spkg/slog"
+)
+
+// Syslog severities (RFC 5424), returned by Severity.
+const (
+	SeverityCritical = 2
+	SeverityError    = 3
+	SeverityWarning  = 4
+	SeverityNotice   = 5
+	SeverityInfo     = 6
+	SeverityDebug    = 7
+)
+
+// Severity maps a level to a syslog severity. Custom levels between
+// LevelInfo and LevelWarning map to the notice severity.
+func Severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelFatal:
+		return SeverityCritical
+	case level >= slog.LevelError:
+		return SeverityError
+	case level >= slog.LevelWarning:
+		return SeverityWarning
+	case level > slog.LevelInfo:
+		return SeverityNotice
+	case level == slog.LevelInfo:
+		return SeverityInfo
+	}
+	return SeverityDebug
+}
+
+// Value formats a property value as a string. Errors are formatted with
+// their Error method, and times in RFC 3339 format with fractional seconds.
+func Value(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
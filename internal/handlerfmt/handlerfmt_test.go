@@ -0,0 +1,32 @@
+package handlerfmt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spkg/slog"
+)
+
+func TestSeverity(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(SeverityDebug, Severity(slog.LevelTrace))
+	assert.Equal(SeverityDebug, Severity(slog.LevelDebug))
+	assert.Equal(SeverityInfo, Severity(slog.LevelInfo))
+	assert.Equal(SeverityNotice, Severity(slog.LevelInfo+5))
+	assert.Equal(SeverityWarning, Severity(slog.LevelWarning))
+	assert.Equal(SeverityError, Severity(slog.LevelError))
+	assert.Equal(SeverityCritical, Severity(slog.LevelFatal))
+	assert.Equal(SeverityCritical, Severity(slog.LevelFatal+5))
+}
+
+func TestValue(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("text", Value("text"))
+	assert.Equal("failed", Value(errors.New("failed")))
+	assert.Equal("2020-01-02T03:04:05.678Z", Value(time.Date(2020, 1, 2, 3, 4, 5, 678000000, time.UTC)))
+	assert.Equal("12.5", Value(12.5))
+	assert.Equal("<nil>", Value(nil))
+}
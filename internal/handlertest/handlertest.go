@@ -0,0 +1,264 @@
+// Package handlertest provides the fixtures shared by the tests of the
+// handler packages: test messages, a stand-in HTTP server that records
+// requests, TCP and UDP servers, and a logger created from a configuration.
+package handlertest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spkg/slog"
+)
+
+// Time is the timestamp of test messages.
+var Time = time.Date(2020, 1, 2, 3, 4, 5, 678901000, time.UTC)
+
+// timeout is how long a test waits for a message to be received.
+const timeout = 5 * time.Second
+
+// Messages returns info messages with the texts and the test timestamp.
+func Messages(texts ...string) []*slog.Message {
+	var msgs []*slog.Message
+	for _, text := range texts {
+		msgs = append(msgs, &slog.Message{Timestamp: Time, Level: slog.LevelInfo, Text: text})
+	}
+	return msgs
+}
+
+// Request is a request received by a Server. The body is decompressed
+// if it was sent with gzip content encoding.
+type Request struct {
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Server is a stand-in for an HTTP API, which records the requests it
+// receives. It responds with its queued statuses in order, and then by
+// calling its responder, or with 200 OK if it has none.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex // protects the following fields
+	requests  []*Request
+	statuses  []int
+	header    http.Header
+	responder func(w http.ResponseWriter, r *Request)
+}
+
+// NewServer starts a server that responds with the statuses before
+// responding normally. The server is closed when the test finishes.
+func NewServer(t testing.TB, statuses ...int) *Server {
+	s := &Server{statuses: statuses, header: make(http.Header)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b, _ = ioutil.ReadAll(zr)
+		}
+		req := &Request{Path: r.URL.Path, Header: r.Header, Body: b}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		for k, v := range s.header {
+			w.Header()[k] = v
+		}
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status = s.statuses[0]
+			s.statuses = s.statuses[1:]
+		}
+		responder := s.responder
+		s.mu.Unlock()
+
+		switch {
+		case status != http.StatusOK:
+			http.Error(w, http.StatusText(status), status)
+		case responder != nil:
+			responder(w, req)
+		default:
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// AddStatuses queues statuses to respond with.
+func (s *Server) AddStatuses(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = append(s.statuses, statuses...)
+}
+
+// SetHeader sets a header of every response.
+func (s *Server) SetHeader(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header.Set(key, value)
+}
+
+// SetResponder sets the function that responds to requests
+// once the queued statuses have been used.
+func (s *Server) SetResponder(f func(w http.ResponseWriter, r *Request)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responder = f
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// Bodies returns the bodies of the requests received so far.
+func (s *Server) Bodies() []string {
+	var bodies []string
+	for _, r := range s.Requests() {
+		bodies = append(bodies, string(r.Body))
+	}
+	return bodies
+}
+
+// TCPServer is a stand-in for a server that accepts a TCP connection
+// and reads messages from it.
+type TCPServer struct {
+	Addr     string
+	t        testing.TB
+	received chan string
+}
+
+// NewTCPServer starts a server that accepts a single connection and reads
+// messages from it with read until it fails. The server is closed when
+// the test finishes.
+func NewTCPServer(t testing.TB, read func(r *bufio.Reader) (string, error)) *TCPServer {
+	ln := listen(t)
+	s := &TCPServer{Addr: ln.Addr().String(), t: t, received: make(chan string, 10)}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := read(r)
+			if err != nil {
+				return
+			}
+			s.received <- msg
+		}
+	}()
+	return s
+}
+
+// Next returns the next message received, and fails the
+// test if no message is received within five seconds.
+func (s *TCPServer) Next() string {
+	s.t.Helper()
+	select {
+	case msg := <-s.received:
+		return msg
+	case <-time.After(timeout):
+		s.t.Fatal("timed out waiting for a message")
+		return ""
+	}
+}
+
+// ListenStalled starts a TCP server that accepts connections but never
+// reads from them, so that writes block once the socket buffers are full.
+// Returns the address of the server, which is closed with its connections
+// when the test finishes.
+func ListenStalled(t testing.TB) string {
+	ln := listen(t)
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	return ln.Addr().String()
+}
+
+// listen returns a TCP listener on a local port, which
+// is closed when the test finishes.
+func listen(t testing.TB) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+// ListenUDP returns a UDP socket on a local port, which
+// is closed when the test finishes.
+func ListenUDP(t testing.TB) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// ReadPacket returns the next datagram received by conn, and fails
+// the test if none is received within five seconds.
+func ReadPacket(t testing.TB, conn net.PacketConn) []byte {
+	t.Helper()
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+// ConfigLogger returns a logger configured with a handler of the type,
+// created by its registered factory from the parameters in JSON format.
+// The logger's output is limited to fatal messages on stderr. The handler
+// is closed when the test finishes.
+func ConfigLogger(t testing.TB, typ, params string) slog.Logger {
+	t.Helper()
+	l := slog.New()
+	err := slog.ReloadConfig(l, []byte(`{
+		"outputs": [{"type": "stderr", "level": "fatal"}],
+		"handlers": [{"type": "`+typ+`", "params": `+params+`}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { slog.ReloadConfig(l, []byte(`{"outputs": [{"type": "stderr", "level": "fatal"}]}`)) })
+	return l
+}
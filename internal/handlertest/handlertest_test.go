@@ -0,0 +1,100 @@
+package handlertest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessages(t *testing.T) {
+	assert := assert.New(t)
+	msgs := Messages("one", "two")
+	if assert.Len(msgs, 2) {
+		assert.Equal("two", msgs[1].Text)
+		assert.Equal(Time, msgs[1].Timestamp)
+	}
+}
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+	s := NewServer(t, http.StatusServiceUnavailable)
+	s.SetHeader("Retry-After", "1")
+	post := func(body string, gzipped bool) *http.Response {
+		var buf bytes.Buffer
+		if gzipped {
+			zw := gzip.NewWriter(&buf)
+			zw.Write([]byte(body))
+			zw.Close()
+		} else {
+			buf.WriteString(body)
+		}
+		req, _ := http.NewRequest("POST", s.URL+"/push", &buf)
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// the statuses are used first
+	resp := post("one", false)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal("1", resp.Header.Get("Retry-After"))
+	resp.Body.Close()
+	resp = post("two", true)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	s.SetResponder(func(w http.ResponseWriter, r *Request) {
+		w.Write(append([]byte("got "), r.Body...))
+	})
+	s.AddStatuses(http.StatusBadRequest)
+	resp = post("three", false)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+	resp = post("four", false)
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal("got four", string(b))
+
+	assert.Equal([]string{"one", "two", "three", "four"}, s.Bodies())
+	assert.Equal("/push", s.Requests()[0].Path)
+}
+
+func TestTCPServer(t *testing.T) {
+	assert := assert.New(t)
+	s := NewTCPServer(t, func(r *bufio.Reader) (string, error) {
+		line, err := r.ReadString('\n')
+		return strings.TrimSuffix(line, "\n"), err
+	})
+	conn, err := net.Dial("tcp", s.Addr)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte("one\ntwo\n"))
+	assert.Equal("one", s.Next())
+	assert.Equal("two", s.Next())
+}
+
+func TestReadPacket(t *testing.T) {
+	assert := assert.New(t)
+	conn := ListenUDP(t)
+	c, err := net.Dial("udp", conn.LocalAddr().String())
+	if !assert.NoError(err) {
+		return
+	}
+	defer c.Close()
+	c.Write([]byte("hello"))
+	assert.Equal("hello", string(ReadPacket(t, conn)))
+}
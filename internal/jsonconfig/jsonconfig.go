@@ -0,0 +1,43 @@
+// Package jsonconfig unmarshals the JSON configuration of handlers.
+package jsonconfig
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Unmarshal unmarshals the JSON object in b into v, where the named
+// fields are durations in the format of time.ParseDuration, such as "5s".
+// In an UnmarshalJSON method, v is a pointer to a type defined from the
+// receiver's type, which does not have the method.
+func Unmarshal(b []byte, v interface{}, durations ...string) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	for _, name := range durations {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			delete(fields, name)
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fields[name] = json.RawMessage(strconv.FormatInt(int64(d), 10))
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
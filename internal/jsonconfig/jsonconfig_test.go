@@ -0,0 +1,26 @@
+package jsonconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshal(t *testing.T) {
+	assert := assert.New(t)
+	var c struct {
+		Name     string        `json:"name"`
+		Interval time.Duration `json:"interval"`
+		Timeout  time.Duration `json:"timeout"`
+	}
+	err := Unmarshal([]byte(`{"name": "a", "interval": "5s", "timeout": ""}`), &c, "interval", "timeout")
+	if assert.NoError(err) {
+		assert.Equal("a", c.Name)
+		assert.Equal(5*time.Second, c.Interval)
+		assert.Equal(time.Duration(0), c.Timeout)
+	}
+	assert.Error(Unmarshal([]byte(`{"interval": "soon"}`), &c, "interval"))
+	assert.Error(Unmarshal([]byte(`{"interval": 5}`), &c, "interval"))
+	assert.Error(Unmarshal([]byte(`[]`), &c, "interval"))
+}
@@ -0,0 +1,47 @@
+// Package redial limits how often the handlers that send messages over a
+// connection try to reconnect to a server that cannot be reached, so that
+// logging is not held up by a connection attempt for every message while
+// the server is down.
+package redial
+
+import "time"
+
+// Delays between connection attempts.
+const (
+	MinBackoff = time.Second
+	MaxBackoff = time.Minute
+)
+
+// Backoff records failed connection attempts. After a failed attempt, no
+// attempt is made until a delay has passed, which starts at MinBackoff and
+// doubles after each consecutive failure up to MaxBackoff. The zero value
+// allows an attempt immediately. A Backoff is not safe for concurrent use.
+type Backoff struct {
+	delay time.Duration // delay after the last failure, zero if none
+	next  time.Time     // time of the next attempt
+}
+
+// Ready reports whether a connection may be attempted at the time.
+func (b *Backoff) Ready(now time.Time) bool {
+	return !now.Before(b.next)
+}
+
+// Fail records a connection attempt that failed at the time.
+func (b *Backoff) Fail(now time.Time) {
+	switch {
+	case b.delay == 0:
+		b.delay = MinBackoff
+	case b.delay < MaxBackoff:
+		b.delay *= 2
+		if b.delay > MaxBackoff {
+			b.delay = MaxBackoff
+		}
+	}
+	b.next = now.Add(b.delay)
+}
+
+// Reset records a successful connection, so that the next
+// attempt can be made immediately.
+func (b *Backoff) Reset() {
+	*b = Backoff{}
+}
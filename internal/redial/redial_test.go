@@ -0,0 +1,33 @@
+package redial
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var b Backoff
+	assert.True(b.Ready(now))
+
+	b.Fail(now)
+	assert.False(b.Ready(now))
+	assert.False(b.Ready(now.Add(MinBackoff - 1)))
+	assert.True(b.Ready(now.Add(MinBackoff)))
+
+	// the delay doubles after each failure, up to the maximum
+	b.Fail(now)
+	assert.False(b.Ready(now.Add(2*MinBackoff - 1)))
+	assert.True(b.Ready(now.Add(2 * MinBackoff)))
+	for i := 0; i < 10; i++ {
+		b.Fail(now)
+	}
+	assert.False(b.Ready(now.Add(MaxBackoff - 1)))
+	assert.True(b.Ready(now.Add(MaxBackoff)))
+
+	b.Reset()
+	assert.True(b.Ready(now))
+}
@@ -0,0 +1,286 @@
+// Package journald provides a slog handler that sends messages to the
+// systemd journal using its native protocol, so that message properties
+// become journal fields that can be queried with journalctl.
+//
+//	h, err := journald.Dial(journald.Config{})
+//	if err != nil {
+//		return err
+//	}
+//	defer h.Close()
+//	slog.AddHandler(h)
+//
+// The message text is sent as MESSAGE, the level as PRIORITY (a syslog
+// severity), and the code as SLOG_CODE. Each property and context value
+// is sent as a field named after its key, in upper case with characters
+// other than letters, digits and underscores replaced by underscores, and
+// prefixed with SLOG_PROP_ if it is the name of a reserved field:
+//
+//	journalctl USER_ID=42 SLOG_CODE=DISK
+//
+// The package registers the "journald" handler type for use in a slog.Config,
+// with a Config in JSON format as its parameters.
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/handlerfmt"
+)
+
+// DefaultPath is the path of the journal's native protocol socket.
+const DefaultPath = "/run/systemd/journal/socket"
+
+// maxFieldName is the maximum length of a journal field name.
+const maxFieldName = 64
+
+// propPrefix is added to the field names of properties that
+// would otherwise have the name of a reserved field.
+const propPrefix = "SLOG_PROP_"
+
+// reservedFields are the fields that have a meaning to the journal,
+// and the fields sent by the handler other than those starting with
+// "SLOG_", which are all reserved.
+var reservedFields = map[string]bool{
+	"MESSAGE":            true,
+	"MESSAGE_ID":         true,
+	"PRIORITY":           true,
+	"CODE_FILE":          true,
+	"CODE_LINE":          true,
+	"CODE_FUNC":          true,
+	"ERRNO":              true,
+	"ERROR":              true,
+	"INVOCATION_ID":      true,
+	"USER_INVOCATION_ID": true,
+	"SYSLOG_FACILITY":    true,
+	"SYSLOG_IDENTIFIER":  true,
+	"SYSLOG_PID":         true,
+	"SYSLOG_TIMESTAMP":   true,
+	"SYSLOG_RAW":         true,
+	"DOCUMENTATION":      true,
+	"TID":                true,
+	"UNIT":               true,
+	"USER_UNIT":          true,
+}
+
+// Config describes the journal socket and the fields sent to it.
+type Config struct {
+	Path       string `json:"path,omitempty"`       // Socket path, default DefaultPath
+	Identifier string `json:"identifier,omitempty"` // SYSLOG_IDENTIFIER field, default is the program name
+	CodeField  string `json:"code_field,omitempty"` // Field for the message code, default "SLOG_CODE"
+	NoCaller   bool   `json:"no_caller,omitempty"`  // Do not send CODE_FILE, CODE_LINE and CODE_FUNC
+}
+
+// Handler is a slog.Handler that sends messages to the systemd journal.
+//
+// Each message is sent in a single datagram. Messages that are too large for
+// a datagram are written to a temporary file, which is unlinked and passed
+// to the journal as a file descriptor.
+//
+// Unless disabled, the source location of the logging call is sent in the
+// CODE_FILE, CODE_LINE and CODE_FUNC fields. This is the first caller outside
+// the slog packages, which is the logging call unless the message was held
+// back (see slog.WithBuffer). A Handler is safe for concurrent use.
+type Handler struct {
+	config Config
+
+	addr *net.UnixAddr
+
+	mu   sync.Mutex // protects conn
+	conn *net.UnixConn
+}
+
+func init() {
+	slog.RegisterHandlerFactory("journald", func(params json.RawMessage) (slog.Handler, error) {
+		var c Config
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &c); err != nil {
+				return nil, err
+			}
+		}
+		return Dial(c)
+	})
+}
+
+// Dial checks that the journal socket exists, and creates
+// a socket for sending messages to it.
+func Dial(c Config) (*Handler, error) {
+	if c.Path == "" {
+		c.Path = DefaultPath
+	}
+	if c.Identifier == "" {
+		c.Identifier = filepath.Base(os.Args[0])
+	}
+	if c.CodeField == "" {
+		c.CodeField = "SLOG_CODE"
+	}
+	if _, err := os.Stat(c.Path); err != nil {
+		return nil, err
+	}
+	// the socket is not connected, as file descriptors
+	// cannot be sent on a connected socket
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{
+		config: c,
+		addr:   &net.UnixAddr{Name: c.Path, Net: "unixgram"},
+		conn:   conn,
+	}, nil
+}
+
+// Handle implements the slog.Handler interface. Messages that cannot
+// be sent are dropped.
+func (h *Handler) Handle(msgs []*slog.Message) {
+	var caller *runtime.Frame
+	if !h.config.NoCaller {
+		caller = callerFrame()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, m := range msgs {
+		h.send(h.encode(m, caller))
+	}
+}
+
+// Close closes the socket used to send messages.
+func (h *Handler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conn.Close()
+}
+
+// send sends the encoded message in a datagram, or in a
+// temporary file if it is too large for a datagram.
+func (h *Handler) send(b []byte) error {
+	_, err := h.conn.WriteToUnix(b, h.addr)
+	if err == nil || !isTooLarge(err) {
+		return err
+	}
+	return sendFile(h.conn, h.addr, b)
+}
+
+// encode returns the message in the journal's native format.
+func (h *Handler) encode(m *slog.Message, caller *runtime.Frame) []byte {
+	var buf bytes.Buffer
+	writeField(&buf, "MESSAGE", m.Text)
+	writeField(&buf, "PRIORITY", strconv.Itoa(handlerfmt.Severity(m.Level)))
+	writeField(&buf, "SYSLOG_IDENTIFIER", h.config.Identifier)
+	if m.Err != nil {
+		writeField(&buf, "ERROR", m.Err.Error())
+	}
+	if m.Logger != "" {
+		writeField(&buf, "SLOG_LOGGER", m.Logger)
+	}
+	if code := m.Code(); code != "" {
+		writeField(&buf, h.config.CodeField, code)
+	}
+	if m.Status() != 0 {
+		writeField(&buf, "SLOG_STATUS", strconv.Itoa(m.Status()))
+	}
+	if caller != nil {
+		writeField(&buf, "CODE_FILE", caller.File)
+		writeField(&buf, "CODE_LINE", strconv.Itoa(caller.Line))
+		writeField(&buf, "CODE_FUNC", caller.Function)
+	}
+	for _, props := range [][]slog.Property{m.Properties, m.Context} {
+		for _, p := range props {
+			if name := FieldName(p.Key); name != "" {
+				if name == h.config.CodeField {
+					name = propPrefix + name
+				}
+				writeField(&buf, name, handlerfmt.Value(p.Value))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeField writes a field in the native protocol format. Values that
+// contain a new line are written in binary form, preceded by their length.
+func writeField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if strings.IndexByte(value, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// FieldName returns the journal field name for a property key. The key is
+// converted to upper case, and characters other than letters, digits and
+// underscores are replaced with underscores. Leading underscores and digits,
+// which are not permitted, are removed. Names of fields that have a meaning
+// to the journal, such as MESSAGE and CODE_FILE, and names starting with
+// "SLOG_" are prefixed with "SLOG_PROP_", so that properties do not replace
+// the fields sent by the handler. The name is truncated to 64 characters.
+// Returns an empty string if no valid name remains.
+func FieldName(key string) string {
+	b := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+		default:
+			c = '_'
+		}
+		if len(b) == 0 && (c == '_' || (c >= '0' && c <= '9')) {
+			continue
+		}
+		b = append(b, c)
+	}
+	if reservedFields[string(b)] || strings.HasPrefix(string(b), "SLOG_") {
+		b = append([]byte(propPrefix), b...)
+	}
+	if len(b) > maxFieldName {
+		b = b[:maxFieldName]
+	}
+	return string(b)
+}
+
+// slogPackage is the import path of the slog package.
+const slogPackage = "github.com/spkg/slog"
+
+// callerFrame returns the first frame on the stack outside the
+// slog packages, excluding their tests.
+func callerFrame() *runtime.Frame {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isSlogFrame(frame) {
+			return &frame
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+func isSlogFrame(frame runtime.Frame) bool {
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	fn := frame.Function
+	return strings.HasPrefix(fn, slogPackage+".") || strings.HasPrefix(fn, slogPackage+"/")
+}
@@ -0,0 +1,97 @@
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spkg/slog"
+)
+
+// parseFields decodes a message in the native protocol format.
+func parseFields(b []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		nl := bytes.IndexByte(b, '\n')
+		if nl < 0 {
+			break
+		}
+		line := string(b[:nl])
+		if eq := strings.IndexByte(line, '='); eq >= 0 {
+			fields[line[:eq]] = line[eq+1:]
+			b = b[nl+1:]
+			continue
+		}
+		size := binary.LittleEndian.Uint64(b[nl+1:])
+		start := nl + 9
+		fields[line] = string(b[start : start+int(size)])
+		b = b[start+int(size)+1:]
+	}
+	return fields
+}
+
+func TestFieldName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("USER_ID", FieldName("user_id"))
+	assert.Equal("REQUEST_PATH", FieldName("request.path"))
+	assert.Equal("A_B", FieldName("__1a-b"))
+	assert.Equal("", FieldName("_123"))
+	assert.Equal(strings.Repeat("X", 64), FieldName(strings.Repeat("x", 100)))
+
+	// reserved fields are prefixed
+	assert.Equal("SLOG_PROP_MESSAGE", FieldName("message"))
+	assert.Equal("SLOG_PROP_PRIORITY", FieldName("Priority"))
+	assert.Equal("SLOG_PROP_CODE_FILE", FieldName("code.file"))
+	assert.Equal("SLOG_PROP_SLOG_CODE", FieldName("slog_code"))
+	assert.Equal("SLOG_PROP_SYSLOG_IDENTIFIER", FieldName("_syslog_identifier"))
+	assert.Equal("MESSAGES", FieldName("messages"))
+}
+
+func TestEncode(t *testing.T) {
+	assert := assert.New(t)
+	h := &Handler{config: Config{Identifier: "app", CodeField: "SLOG_CODE"}}
+	m := &slog.Message{
+		Timestamp:  time.Now(),
+		Level:      slog.LevelWarning,
+		Text:       "first line\nsecond line",
+		Err:        errors.New("failed"),
+		Logger:     "db",
+		Properties: []slog.Property{{Key: "user.id", Value: 42}, {Key: "_hidden", Value: true}},
+		Context:    []slog.Property{{Key: "request", Value: "abc"}},
+	}
+	m.SetCode("DISK")
+	m.SetStatus(503)
+
+	fields := parseFields(h.encode(m, nil))
+	assert.Equal(map[string]string{
+		"MESSAGE":           "first line\nsecond line",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "app",
+		"ERROR":             "failed",
+		"SLOG_LOGGER":       "db",
+		"SLOG_CODE":         "DISK",
+		"SLOG_STATUS":       "503",
+		"USER_ID":           "42",
+		"HIDDEN":            "true",
+		"REQUEST":           "abc",
+	}, fields)
+
+	// properties do not replace the fields sent by the handler
+	h.config.CodeField = "EVENT_CODE"
+	m = &slog.Message{
+		Level:      slog.LevelInfo,
+		Text:       "text",
+		Properties: []slog.Property{{Key: "message", Value: "property"}, {Key: "event.code", Value: "property"}},
+	}
+	m.SetCode("CODE")
+	fields = parseFields(h.encode(m, nil))
+	assert.Equal("text", fields["MESSAGE"])
+	assert.Equal("property", fields["SLOG_PROP_MESSAGE"])
+	assert.Equal("CODE", fields["EVENT_CODE"])
+	assert.Equal("property", fields["SLOG_PROP_EVENT_CODE"])
+}
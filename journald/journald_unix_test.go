@@ -0,0 +1,99 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package journald
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+
+	"github.com/spkg/slog"
+)
+
+// listen creates a stand-in for the journal socket.
+func listen(t *testing.T) (*net.UnixConn, string) {
+	dir, err := ioutil.TempDir("", "journald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip("unixgram not supported:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+// receive reads a message from the socket, reading it from the
+// file descriptor if one is passed.
+func receive(t *testing.T, conn *net.UnixConn) (map[string]string, bool) {
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oobn == 0 {
+		return parseFields(buf[:n]), false
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatal("bad control message", err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatal("bad unix rights", err)
+	}
+	file := os.NewFile(uintptr(fds[0]), "journal")
+	defer file.Close()
+	file.Seek(0, 0)
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseFields(b), true
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+	conn, path := listen(t)
+	h, err := Dial(Config{Path: path, Identifier: "test"})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	l := slog.New()
+	l.SetOutput(ioutil.Discard)
+	l.AddHandler(h)
+
+	l.Info(context.Background(), "hello", slog.WithValue("user", "alice"))
+	fields, viaFile := receive(t, conn)
+	assert.False(viaFile)
+	assert.Equal("hello", fields["MESSAGE"])
+	assert.Equal("6", fields["PRIORITY"])
+	assert.Equal("alice", fields["USER"])
+	assert.Equal("journald_unix_test.go", filepath.Base(fields["CODE_FILE"]))
+	assert.Equal("github.com/spkg/slog/journald.TestHandler", fields["CODE_FUNC"])
+	assert.NotEmpty(fields["CODE_LINE"])
+
+	// too large for a datagram
+	large := strings.Repeat("x", 4<<20)
+	l.Error(context.Background(), "large", slog.WithValue("data", large))
+	fields, viaFile = receive(t, conn)
+	assert.True(viaFile)
+	assert.Equal("large", fields["MESSAGE"])
+	assert.Equal(large, fields["DATA"])
+}
@@ -0,0 +1,19 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package journald
+
+import (
+	"errors"
+	"net"
+)
+
+var errNotSupported = errors.New("journald: not supported")
+
+func isTooLarge(err error) bool {
+	return false
+}
+
+func sendFile(conn *net.UnixConn, addr *net.UnixAddr, b []byte) error {
+	return errNotSupported
+}
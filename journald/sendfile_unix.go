@@ -0,0 +1,50 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package journald
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+)
+
+// shmDir is the preferred directory for temporary files passed to the
+// journal, as it is memory backed on systems that run systemd.
+const shmDir = "/dev/shm"
+
+// isTooLarge reports whether a write failed because the
+// message is too large to send in a datagram.
+func isTooLarge(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
+
+// sendFile writes the message to a temporary file, unlinks the file, and
+// sends its file descriptor to the journal, which reads the message from it.
+func sendFile(conn *net.UnixConn, addr *net.UnixAddr, b []byte) error {
+	dir := shmDir
+	if _, err := os.Stat(dir); err != nil {
+		dir = os.TempDir()
+	}
+	file, err := ioutil.TempFile(dir, "journal.")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := os.Remove(file.Name()); err != nil {
+		return err
+	}
+	if _, err := file.Write(b); err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(file.Fd()))
+	_, _, err = conn.WriteMsgUnix(nil, rights, addr)
+	return err
+}
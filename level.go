@@ -4,32 +4,123 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 )
 
 // Level indicates the level of a log message.
 type Level int
 
-// Values for Level.
+// Values for Level. The values are spaced apart so that custom
+// levels can be registered in between them. See RegisterLevel.
+//
+// The zero Level is reserved: it is not a valid level, and where
+// a level is used as a bound, such as in AddLevelHandler, zero
+// means that there is no bound.
 const (
-	LevelDebug   Level = iota // Debugging only
-	LevelInfo                 // Informational
-	LevelWarning              // Warning
-	LevelError                // Error condition
+	LevelTrace   Level = 10 // Very detailed diagnostics
+	LevelDebug   Level = 20 // Debugging only
+	LevelInfo    Level = 30 // Informational
+	LevelWarning Level = 40 // Warning
+	LevelError   Level = 50 // Error condition
+	LevelFatal   Level = 60 // Fatal condition, program exits
 )
 
-// MinLevel is the minimum level that will be logged.
-// The calling program can change this value at any time.
 var (
-	MinLevel = LevelInfo
+	errInvalidLevel     = errors.New("invalid level")
+	errLevelNameMissing = errors.New("level name missing")
+	errLevelNameExists  = errors.New("level name already registered")
+	errLevelExists      = errors.New("level already registered")
+	errLevelNotPositive = errors.New("level must be greater than zero")
 )
 
-var (
-	errInvalidLevel = errors.New("invalid level")
+// Color is a terminal color associated with a level.
+type Color int
+
+// Values for Color.
+const (
+	ColorNone Color = iota
+	ColorRed
+	ColorGreen
+	ColorYellow
+	ColorBlue
+	ColorMagenta
+	ColorCyan
+	ColorWhite
+	ColorGray
 )
 
+// LevelDef describes a custom level. Custom levels are registered
+// using the RegisterLevel function.
+type LevelDef struct {
+	Name   string // Name used for display and parsing, eg "audit"
+	Level  Level  // Numeric severity, compared with the minimum level
+	Color  Color  // Optional color used for terminal output
+	Always bool   // Logged regardless of the minimum level
+}
+
+// levels is the registry of custom levels.
+var levels = struct {
+	sync.RWMutex
+	byLevel map[Level]LevelDef
+	byName  map[string]LevelDef
+}{
+	byLevel: make(map[Level]LevelDef),
+	byName:  make(map[string]LevelDef),
+}
+
+// RegisterLevel registers a custom level. Once registered the level can be
+// used in the same way as the predefined levels: it can be logged using the
+// Log function, compared with the minimum level, and parsed by UnmarshalText.
+//
+// Level names are case-insensitive. It is an error to register a name
+// or a level that is already in use, unless the definition is identical
+// to the existing definition. Custom levels must be greater than zero,
+// as the zero Level is reserved.
+func RegisterLevel(def LevelDef) error {
+	def.Name = strings.ToLower(def.Name)
+	if def.Name == "" {
+		return errLevelNameMissing
+	}
+	if def.Level <= 0 {
+		return errLevelNotPositive
+	}
+	var builtin Level
+	if builtin.unmarshalBuiltin(def.Name) {
+		return errLevelNameExists
+	}
+	if def.Level.isBuiltin() {
+		return errLevelExists
+	}
+
+	levels.Lock()
+	defer levels.Unlock()
+	if existing, ok := levels.byName[def.Name]; ok {
+		if existing == def {
+			return nil
+		}
+		return errLevelNameExists
+	}
+	if _, ok := levels.byLevel[def.Level]; ok {
+		return errLevelExists
+	}
+	levels.byName[def.Name] = def
+	levels.byLevel[def.Level] = def
+	return nil
+}
+
+// lookupLevel returns the definition for a custom level.
+func lookupLevel(lvl Level) (LevelDef, bool) {
+	levels.RLock()
+	defer levels.RUnlock()
+	def, ok := levels.byLevel[lvl]
+	return def, ok
+}
+
 // String implements the String interface.
 func (lvl Level) String() string {
 	switch lvl {
+	case LevelTrace:
+		return "trace"
 	case LevelDebug:
 		return "debug"
 	case LevelInfo:
@@ -38,10 +129,51 @@ func (lvl Level) String() string {
 		return "warn"
 	case LevelError:
 		return "error"
+	case LevelFatal:
+		return "fatal"
+	}
+	if def, ok := lookupLevel(lvl); ok {
+		return def.Name
 	}
 	return fmt.Sprintf("unknown %d", lvl)
 }
 
+// Color returns the terminal color associated with the level.
+func (lvl Level) Color() Color {
+	switch lvl {
+	case LevelTrace, LevelDebug:
+		return ColorGray
+	case LevelInfo:
+		return ColorGreen
+	case LevelWarning:
+		return ColorYellow
+	case LevelError, LevelFatal:
+		return ColorRed
+	}
+	if def, ok := lookupLevel(lvl); ok {
+		return def.Color
+	}
+	return ColorNone
+}
+
+// always reports whether messages at this level are logged
+// regardless of the minimum level.
+func (lvl Level) always() bool {
+	if lvl.isBuiltin() {
+		return false
+	}
+	def, ok := lookupLevel(lvl)
+	return ok && def.Always
+}
+
+func (lvl Level) isBuiltin() bool {
+	switch lvl {
+	case LevelTrace, LevelDebug, LevelInfo, LevelWarning, LevelError, LevelFatal:
+		return true
+	}
+	return false
+}
+
 // MarshalText implements the encoding.TextMarshaler interface.
 func (lvl Level) MarshalText() ([]byte, error) {
 	return []byte(lvl.String()), nil
@@ -50,7 +182,23 @@ func (lvl Level) MarshalText() ([]byte, error) {
 // UnmarshalText implements the encoding.TextUnmarshaler interface.
 func (lvl *Level) UnmarshalText(text []byte) error {
 	str := strings.ToLower(string(text))
+	if lvl.unmarshalBuiltin(str) {
+		return nil
+	}
+
+	levels.RLock()
+	defer levels.RUnlock()
+	if def, ok := levels.byName[str]; ok {
+		*lvl = def.Level
+		return nil
+	}
+	return errInvalidLevel
+}
+
+func (lvl *Level) unmarshalBuiltin(str string) bool {
 	switch str {
+	case "trace":
+		*lvl = LevelTrace
 	case "debug":
 		*lvl = LevelDebug
 	case "info", "information":
@@ -59,8 +207,10 @@ func (lvl *Level) UnmarshalText(text []byte) error {
 		*lvl = LevelWarning
 	case "error":
 		*lvl = LevelError
+	case "fatal":
+		*lvl = LevelFatal
 	default:
-		return errInvalidLevel
+		return false
 	}
-	return nil
+	return true
 }
@@ -14,10 +14,12 @@ func TestString(t *testing.T) {
 		Level    slog.Level
 		Expected string
 	}{
+		{slog.LevelTrace, "trace"},
 		{slog.LevelDebug, "debug"},
 		{slog.LevelInfo, "info"},
 		{slog.LevelWarning, "warn"},
 		{slog.LevelError, "error"},
+		{slog.LevelFatal, "fatal"},
 		{slog.Level(63), "unknown 63"},
 	}
 
@@ -48,10 +50,12 @@ func TestMarshalText(t *testing.T) {
 		Valid    []string
 		Invalid  []string
 	}{
+		{Level: slog.LevelTrace, Expected: "trace", Valid: []string{"Trace", "TRACE"}},
 		{Level: slog.LevelDebug, Expected: "debug", Valid: []string{"Debug", "DEBUG"}},
 		{Level: slog.LevelInfo, Expected: "info", Valid: []string{"INFO", "information"}, Invalid: []string{"xxxx"}},
 		{Level: slog.LevelWarning, Expected: "warn", Valid: []string{"Warning", "WARN"}},
 		{Level: slog.LevelError, Expected: "error"},
+		{Level: slog.LevelFatal, Expected: "fatal", Valid: []string{"FATAL"}},
 	}
 
 	for _, tc := range testCases {
@@ -75,3 +79,61 @@ func TestMarshalText(t *testing.T) {
 		}
 	}
 }
+
+func TestRegisterLevel(t *testing.T) {
+	assert := assert.New(t)
+	levelNotice := slog.LevelInfo + 5
+	def := slog.LevelDef{Name: "Notice", Level: levelNotice, Color: slog.ColorCyan}
+	assert.NoError(slog.RegisterLevel(def))
+
+	// identical definition can be registered again
+	assert.NoError(slog.RegisterLevel(def))
+
+	assert.Equal("notice", levelNotice.String())
+	assert.Equal(slog.ColorCyan, levelNotice.Color())
+	b, err := levelNotice.MarshalText()
+	assert.NoError(err)
+	assert.Equal("notice", string(b))
+
+	var level slog.Level
+	assert.NoError(level.UnmarshalText([]byte("NOTICE")))
+	assert.Equal(levelNotice, level)
+	assert.True(levelNotice > slog.LevelInfo)
+	assert.True(levelNotice < slog.LevelWarning)
+
+	testCases := []slog.LevelDef{
+		{Name: "", Level: slog.LevelInfo + 6},
+		{Name: "warning", Level: slog.LevelInfo + 6},
+		{Name: "notice", Level: slog.LevelInfo + 6},
+		{Name: "other", Level: levelNotice},
+		{Name: "other", Level: slog.LevelError},
+		{Name: "other", Level: 0},
+		{Name: "other", Level: -5},
+	}
+	for _, tc := range testCases {
+		assert.Error(slog.RegisterLevel(tc), tc.Name)
+	}
+}
+
+func TestLevelVar(t *testing.T) {
+	assert := assert.New(t)
+
+	var v slog.LevelVar
+	assert.Equal(slog.LevelInfo, v.Level())
+	v.Set(slog.LevelTrace)
+	assert.Equal(slog.LevelTrace, v.Level())
+	assert.Equal("LevelVar(trace)", v.String())
+
+	v2 := slog.NewLevelVar(slog.LevelError)
+	assert.Equal(slog.LevelError, v2.Level())
+
+	s := struct{ Level *slog.LevelVar }{v2}
+	b, err := json.Marshal(&s)
+	assert.NoError(err)
+	assert.Equal(`{"Level":"error"}`, string(b))
+
+	assert.NoError(v2.UnmarshalText([]byte("debug")))
+	assert.Equal(slog.LevelDebug, v2.Level())
+	assert.Error(v2.UnmarshalText([]byte("xxxx")))
+	assert.Equal(slog.LevelDebug, v2.Level())
+}
@@ -0,0 +1,226 @@
+package slog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// levelHandler implements the http.Handler returned by NewLevelHandler.
+type levelHandler struct {
+	mu      sync.Mutex              // protects the following fields
+	reverts map[string]*levelRevert // pending reverts, keyed by logger name
+}
+
+// levelRevert is a pending revert of a logger's minimum level.
+type levelRevert struct {
+	timer     *time.Timer
+	at        time.Time
+	level     Level // level to revert to
+	inherited bool  // revert a named logger to inherit its level
+}
+
+// levelState is the JSON representation of a logger's minimum level.
+type levelState struct {
+	Logger    string     `json:"logger,omitempty"`
+	Level     Level      `json:"level"`
+	Inherited bool       `json:"inherited,omitempty"`
+	RevertAt  *time.Time `json:"revert_at,omitempty"`
+}
+
+// levelRequest is the JSON request body for changing a logger's minimum level.
+type levelRequest struct {
+	Logger string `json:"logger"`
+	Level  Level  `json:"level"`
+	TTL    string `json:"ttl"`
+}
+
+// NewLevelHandler returns a http.Handler that reports and changes the minimum
+// level of the default logger and of named loggers at runtime.
+//
+// A GET request returns the minimum level of the default logger and all named
+// loggers as JSON. If the "logger" query parameter is present, only the level
+// of that logger is returned. A logger name of "" refers to the default logger.
+//
+// A PUT request changes the minimum level. The request body is either plain text
+// containing the level name, or (if the content type is application/json) a JSON
+// object with "level", "logger" and "ttl" fields. The logger and TTL can also be
+// specified with the "logger" and "ttl" query parameters. If a TTL is specified
+// (eg "5m"), the level reverts to its previous value after the TTL has expired.
+//
+//	curl -X PUT -d debug 'http://localhost:8080/debug/level?logger=db&ttl=5m'
+func NewLevelHandler() http.Handler {
+	return &levelHandler{
+		reverts: make(map[string]*levelRevert),
+	}
+}
+
+func (h *levelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		h.get(w, r)
+	case "PUT", "POST":
+		h.put(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *levelHandler) get(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.URL.Query()["logger"]; ok {
+		name := r.URL.Query().Get("logger")
+		l := findLogger(name)
+		if l == nil {
+			http.Error(w, "logger not found", http.StatusNotFound)
+			return
+		}
+		if strings.Contains(r.Header.Get("Accept"), "text/plain") {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(l.LevelVar().Level().String() + "\n"))
+			return
+		}
+		writeJSON(w, http.StatusOK, h.state(name, l))
+		return
+	}
+
+	var states []levelState
+	if l, ok := Default.(*loggerImpl); ok {
+		states = append(states, h.state("", l))
+	}
+	for _, name := range namedLoggers() {
+		states = append(states, h.state(name, lookupNamed(name)))
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+func (h *levelHandler) put(w http.ResponseWriter, r *http.Request) {
+	req := levelRequest{
+		Logger: r.URL.Query().Get("logger"),
+		TTL:    r.URL.Query().Get("ttl"),
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 4096))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err = json.Unmarshal(body, &req)
+	} else {
+		err = req.Level.UnmarshalText([]byte(strings.TrimSpace(string(body))))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validLevel(req.Level) {
+		http.Error(w, "missing or invalid level", http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	l := findLogger(req.Logger)
+	if l == nil {
+		http.Error(w, "logger not found", http.StatusNotFound)
+		return
+	}
+	h.setLevel(req.Logger, l, req.Level, ttl)
+	writeJSON(w, http.StatusOK, h.state(req.Logger, l))
+}
+
+// validLevel reports whether lvl is a built-in or registered level. The
+// zero Level is not valid, so a request without a level is rejected.
+func validLevel(lvl Level) bool {
+	if lvl.isBuiltin() {
+		return true
+	}
+	_, ok := lookupLevel(lvl)
+	return ok
+}
+
+// setLevel sets the minimum level of the logger. If ttl is non-zero,
+// the level reverts to the level in effect before the first of any
+// consecutive changes made with a TTL.
+func (h *levelHandler) setLevel(name string, l *loggerImpl, level Level, ttl time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	revert := h.reverts[name]
+	if revert != nil {
+		revert.timer.Stop()
+		delete(h.reverts, name)
+	}
+	if ttl > 0 {
+		if revert == nil {
+			revert = &levelRevert{
+				level:     l.LevelVar().Level(),
+				inherited: l.inheritsLevel(),
+			}
+		}
+		revert.at = time.Now().Add(ttl)
+		revert.timer = time.AfterFunc(ttl, func() {
+			h.revert(name, l, revert)
+		})
+		h.reverts[name] = revert
+	}
+	l.SetMinLevel(level)
+}
+
+// revert restores the logger's minimum level after its TTL has expired.
+func (h *levelHandler) revert(name string, l *loggerImpl, revert *levelRevert) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.reverts[name] != revert {
+		// superseded by a later change
+		return
+	}
+	delete(h.reverts, name)
+	if revert.inherited {
+		l.SetLevelVar(nil)
+	} else {
+		l.SetMinLevel(revert.level)
+	}
+}
+
+func (h *levelHandler) state(name string, l *loggerImpl) levelState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state := levelState{
+		Logger:    name,
+		Level:     l.LevelVar().Level(),
+		Inherited: l.inheritsLevel(),
+	}
+	if revert := h.reverts[name]; revert != nil {
+		at := revert.at
+		state.RevertAt = &at
+	}
+	return state
+}
+
+// findLogger returns the default logger if name is empty,
+// otherwise the named logger, if it exists.
+func findLogger(name string) *loggerImpl {
+	if name == "" {
+		l, _ := Default.(*loggerImpl)
+		return l
+	}
+	return lookupNamed(name)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.Encode(v)
+}
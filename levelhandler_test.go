@@ -0,0 +1,127 @@
+package slog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelHandlerGet(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	Named("test-level-get").SetMinLevel(LevelError)
+	h := NewLevelHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	var states []levelState
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &states))
+	assert.Equal("", states[0].Logger)
+	assert.Equal(LevelInfo, states[0].Level)
+	var found bool
+	for _, state := range states {
+		if state.Logger == "test-level-get" {
+			found = true
+			assert.Equal(LevelError, state.Level)
+		}
+	}
+	assert.True(found)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/?logger=test-level-get", nil)
+	r.Header.Set("Accept", "text/plain")
+	h.ServeHTTP(w, r)
+	assert.Equal("error\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/?logger=test-level-missing", nil))
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("DELETE", "/", nil))
+	assert.Equal(http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestLevelHandlerPut(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	h := NewLevelHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/", strings.NewReader("debug\n")))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(LevelDebug, Default.LevelVar().Level())
+
+	db := Named("test-level-put")
+	r := httptest.NewRequest("PUT", "/", strings.NewReader(`{"logger":"test-level-put","level":"warn"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(LevelWarning, db.LevelVar().Level())
+	assert.Equal(LevelDebug, Default.LevelVar().Level())
+
+	for _, tc := range []struct {
+		URL    string
+		Body   string
+		Status int
+	}{
+		{"/", "xxxx", http.StatusBadRequest},
+		{"/?ttl=xxxx", "info", http.StatusBadRequest},
+		{"/?ttl=-1s", "info", http.StatusBadRequest},
+		{"/?logger=test-level-missing", "info", http.StatusNotFound},
+	} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("PUT", tc.URL, strings.NewReader(tc.Body)))
+		assert.Equal(tc.Status, w.Code, tc.URL)
+	}
+
+	// a JSON body without a level does not change anything
+	for _, body := range []string{`{"ttl":"5m"}`, `{"level":""}`, `{"level":35}`} {
+		r = httptest.NewRequest("PUT", "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(http.StatusBadRequest, w.Code, body)
+	}
+	assert.Equal(LevelDebug, Default.LevelVar().Level())
+}
+
+func TestLevelHandlerTTL(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	h := NewLevelHandler()
+	db := Named("test-level-ttl")
+
+	// two consecutive changes revert to the original level
+	for _, level := range []string{"debug", "trace"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("PUT", "/?logger=test-level-ttl&ttl=50ms", strings.NewReader(level)))
+		assert.Equal(http.StatusOK, w.Code)
+		var state levelState
+		assert.NoError(json.Unmarshal(w.Body.Bytes(), &state))
+		assert.NotNil(state.RevertAt)
+	}
+	assert.Equal(LevelTrace, db.LevelVar().Level())
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(LevelInfo, db.LevelVar().Level())
+	assert.True(db.(*loggerImpl).inheritsLevel())
+
+	// a change without a TTL cancels a pending revert
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/?ttl=50ms", strings.NewReader("debug")))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/", strings.NewReader("error")))
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(LevelError, Default.LevelVar().Level())
+}
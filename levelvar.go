@@ -0,0 +1,48 @@
+package slog
+
+import "sync/atomic"
+
+// LevelVar is a Level variable that can be shared between Loggers.
+// It can be read and changed at any time from any goroutine without
+// additional locking. The zero value of LevelVar is LevelInfo.
+type LevelVar struct {
+	// offset from LevelInfo, so that the zero value is LevelInfo
+	v int64
+}
+
+// NewLevelVar returns a new LevelVar initialised to level.
+func NewLevelVar(level Level) *LevelVar {
+	v := &LevelVar{}
+	v.Set(level)
+	return v
+}
+
+// Level returns the current value of the variable.
+func (v *LevelVar) Level() Level {
+	return Level(atomic.LoadInt64(&v.v)) + LevelInfo
+}
+
+// Set changes the value of the variable.
+func (v *LevelVar) Set(level Level) {
+	atomic.StoreInt64(&v.v, int64(level-LevelInfo))
+}
+
+// String implements the fmt.Stringer interface.
+func (v *LevelVar) String() string {
+	return "LevelVar(" + v.Level().String() + ")"
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (v *LevelVar) MarshalText() ([]byte, error) {
+	return v.Level().MarshalText()
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (v *LevelVar) UnmarshalText(text []byte) error {
+	var level Level
+	if err := level.UnmarshalText(text); err != nil {
+		return err
+	}
+	v.Set(level)
+	return nil
+}
@@ -11,6 +11,12 @@ var (
 	Default = New()
 )
 
+// Trace logs a trace level message to the default logger.
+// Returns a non-nil *Message, which can be used as an error value.
+func Trace(ctx context.Context, text string, opts ...Option) *Message {
+	return Default.Trace(ctx, text, opts...)
+}
+
 // Debug logs a debug level message to the default logger.
 // Returns a non-nil *Message, which can be used as an error value.
 func Debug(ctx context.Context, text string, opts ...Option) *Message {
@@ -35,20 +41,87 @@ func Error(ctx context.Context, text string, opts ...Option) *Message {
 	return Default.Error(ctx, text, opts...)
 }
 
+// Fatal logs a fatal level message to the default logger, flushes
+// its output and handlers, and then exits the program.
+func Fatal(ctx context.Context, text string, opts ...Option) {
+	Default.Fatal(ctx, text, opts...)
+}
+
+// Log logs a message at the specified level to the default logger. The level
+// can be one of the predefined levels, or a custom level registered using
+// RegisterLevel. Returns a non-nil *Message, which can be used as an error value.
+func Log(ctx context.Context, level Level, text string, opts ...Option) *Message {
+	return Default.Log(ctx, level, text, opts...)
+}
+
 // SetOutput sets the output writer for the default logger.
 func SetOutput(w io.Writer) {
 	Default.SetOutput(w)
 }
 
+// SetFormatter sets the format of messages written to the output of the
+// default logger. By default messages are written in logfmt format.
+func SetFormatter(f Formatter) {
+	Default.SetFormatter(f)
+}
+
+// SetSinks replaces the additional outputs of the default logger.
+func SetSinks(sinks ...Sink) {
+	Default.SetSinks(sinks...)
+}
+
+// AddSink appends an additional output to the default logger.
+func AddSink(s Sink) {
+	Default.AddSink(s)
+}
+
 // SetMinLevel sets the minimum log level for the default logger. By default
 // the minimum log level is LevelInfo.
 func SetMinLevel(level Level) {
 	Default.SetMinLevel(level)
 }
 
+// SetExitCode sets the exit code used by the default logger when a fatal
+// message is logged. By default the exit code is 1.
+func SetExitCode(code int) {
+	Default.SetExitCode(code)
+}
+
+// SetClock sets the clock used for the timestamps of messages logged to the
+// default logger, and to named loggers that do not have their own clock.
+// Setting a nil clock restores the system clock.
+func SetClock(c Clock) {
+	Default.SetClock(c)
+}
+
+// SetLevelVar sets the LevelVar that determines the minimum log level
+// of the default logger. The LevelVar can be shared with other loggers.
+func SetLevelVar(v *LevelVar) {
+	Default.SetLevelVar(v)
+}
+
 // AddHandler appends the handler to the list of handlers for the default logger.
-func AddHandler(h Handler) {
-	Default.AddHandler(h)
+// The returned registration can be used to remove the handler.
+func AddHandler(h Handler) *HandlerRegistration {
+	return Default.AddHandler(h)
+}
+
+// ReplaceHandlers replaces all of the handlers for the default logger.
+// Calling ReplaceHandlers with no arguments removes all handlers.
+func ReplaceHandlers(handlers ...Handler) {
+	Default.ReplaceHandlers(handlers...)
+}
+
+// AddLevelHandler appends a handler for the default logger that only receives
+// messages with levels between minLevel and maxLevel inclusive. A zero minLevel
+// or maxLevel means no minimum or maximum respectively.
+func AddLevelHandler(h Handler, minLevel, maxLevel Level) *HandlerRegistration {
+	return Default.AddLevelHandler(h, minLevel, maxLevel)
+}
+
+// Flush flushes the output and handlers of the default logger.
+func Flush() error {
+	return Default.Flush()
 }
 
 // NewWriter creates a new writer that can be used to integrate with the
@@ -2,7 +2,9 @@ package slog
 
 import (
 	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -35,12 +37,213 @@ func TestLog(t *testing.T) {
 	Error(ctx, "error message")
 	assert.Equal(4, len(th.Messages))
 
+	SetMinLevel(LevelTrace)
+	th.Messages = nil
+	Trace(ctx, "trace message")
+	assert.Equal(1, len(th.Messages))
+	assert.Equal(LevelTrace, th.Messages[0].Level)
+}
+
+func TestContextMinLevel(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	l.AddHandler(th)
+	ctx := context.Background()
+	debugCtx := NewContext(WithMinLevel(ctx, LevelDebug), Property{"a", "b"})
+	errorCtx := WithMinLevel(ctx, LevelError)
+
+	l.Debug(ctx, "debug message")
+	l.Debug(debugCtx, "debug message")
+	assert.Equal(1, len(th.Messages))
+
+	th.Messages = nil
+	l.Warn(ctx, "warn message")
+	l.Warn(errorCtx, "warn message")
+	assert.Equal(1, len(th.Messages))
+}
+
+func TestSharedLevelVar(t *testing.T) {
+	assert := assert.New(t)
+	l1 := New()
+	l2 := New()
+	l1.SetOutput(ioutil.Discard)
+	l2.SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	l1.AddHandler(th)
+	l2.AddHandler(th)
+	ctx := context.Background()
+
+	v := NewLevelVar(LevelWarning)
+	l1.SetLevelVar(v)
+	l2.SetLevelVar(v)
+	assert.Exactly(v, l1.LevelVar())
+
+	l1.Info(ctx, "info message")
+	l2.Info(ctx, "info message")
+	assert.Equal(0, len(th.Messages))
+
+	// changing the level from another goroutine affects both loggers
+	done := make(chan struct{})
+	go func() {
+		v.Set(LevelDebug)
+		close(done)
+	}()
+	<-done
+	l1.Debug(ctx, "debug message")
+	l2.Debug(ctx, "debug message")
+	assert.Equal(2, len(th.Messages))
+
+	// SetMinLevel changes the shared variable
+	l2.SetMinLevel(LevelError)
+	assert.Equal(LevelError, v.Level())
+	assert.Equal(LevelError, l1.LevelVar().Level())
+}
+
+func TestLogCustomLevel(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	AddHandler(th)
+	ctx := context.Background()
+
+	levelAudit := LevelWarning + 1
+	levelVerbose := LevelDebug + 1
+	assert.NoError(RegisterLevel(LevelDef{Name: "testaudit", Level: levelAudit, Always: true}))
+	assert.NoError(RegisterLevel(LevelDef{Name: "testverbose", Level: levelVerbose}))
+
+	// audit level is logged regardless of the minimum level
+	SetMinLevel(LevelFatal)
+	Log(ctx, levelAudit, "audit message")
+	Log(ctx, levelVerbose, "verbose message")
+	assert.Equal(1, len(th.Messages))
+	assert.Equal(levelAudit, th.Messages[0].Level)
+	assert.Contains(th.Messages[0].Logfmt(), " testaudit ")
+
+	SetMinLevel(LevelDebug)
+	th.Messages = nil
+	Log(ctx, levelVerbose, "verbose message")
+	Log(ctx, LevelDebug, "debug message")
+	assert.Equal(2, len(th.Messages))
+}
+
+func TestFatal(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	exitCode := -1
+	exit = func(code int) { exitCode = code }
+	defer func() { exit = os.Exit }()
+
+	SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	AddHandler(th)
+	ctx := context.Background()
+
+	Fatal(ctx, "fatal message")
+	assert.Equal(1, exitCode)
+	assert.Equal(1, len(th.Messages))
+	assert.Equal(LevelFatal, th.Messages[0].Level)
+	assert.Equal(1, th.Flushed)
+
+	SetExitCode(3)
+	Fatal(ctx, "fatal message")
+	assert.Equal(3, exitCode)
+	assert.Equal(2, th.Flushed)
+}
+
+func TestFlushLogs(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	exit = func(code int) {}
+	defer func() { exit = os.Exit }()
+
+	SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	AddHandler(th)
+	AddHandler(&loggingFlusher{})
+	ctx := context.Background()
+
+	// a handler that logs while being flushed does not deadlock
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Fatal(ctx, "fatal message")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock flushing handlers")
+	}
+	if assert.Equal(2, len(th.Messages)) {
+		assert.Equal("flushing", th.Messages[1].Text)
+	}
+}
+
+func TestHandlerLogs(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+
+	SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	AddHandler(th)
+	ctx := context.Background()
+	AddHandler(HandlerFunc(func(msgs []*Message) {
+		for _, m := range msgs {
+			switch m.Text {
+			case "first":
+				Warn(ctx, "logged by handler")
+			case "second":
+				Named("test-handler-logs").Warn(ctx, "logged through named logger")
+			}
+		}
+	}))
+
+	// a handler that logs to its own logger, or to a named logger
+	// that passes messages on to it, does not deadlock
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Info(ctx, "first")
+		Info(ctx, "second")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock logging from a handler")
+	}
+	var texts []string
+	for _, m := range th.Messages {
+		texts = append(texts, m.Text)
+	}
+	assert.Equal([]string{"first", "logged by handler", "second", "logged through named logger"}, texts)
+}
+
+// loggingFlusher is a handler that logs a message when it is flushed.
+type loggingFlusher struct{}
+
+func (lf *loggingFlusher) Handle(msgs []*Message) {}
+
+func (lf *loggingFlusher) Flush() error {
+	Info(context.Background(), "flushing")
+	return nil
 }
 
 type testHandler struct {
 	Messages []*Message
+	Flushed  int
 }
 
 func (th *testHandler) Handle(msgs []*Message) {
 	th.Messages = append(th.Messages, msgs...)
 }
+
+func (th *testHandler) Flush() error {
+	th.Flushed++
+	return nil
+}
@@ -0,0 +1,132 @@
+package logfile
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// ReopenFile is an io.Writer that writes to a file, and reopens the file
+// when told to. It is used with an external log rotation program such as
+// logrotate in "create" mode: the program renames the log file, and then
+// signals the process, which reopens the file at the original path.
+//
+// Loggers write each message with a single call to Write, and Reopen
+// waits for any write in progress to complete, so a message is never
+// split between the old file and the new one. A ReopenFile is safe for
+// concurrent use.
+type ReopenFile struct {
+	path string
+
+	mu     sync.Mutex // protects the following fields
+	file   *os.File
+	closed bool
+}
+
+// NewReopenFile opens the file at path for appending, creating the file
+// and its directory if necessary.
+func NewReopenFile(path string) (*ReopenFile, error) {
+	file, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ReopenFile{
+		path: path,
+		file: file,
+	}, nil
+}
+
+// Write implements the io.Writer interface.
+func (f *ReopenFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, errClosed
+	}
+	return f.file.Write(p)
+}
+
+// Reopen closes the file and opens the file at the same path, creating it if
+// it no longer exists. If the file cannot be opened, writes continue to the
+// previous file and an error is returned.
+func (f *ReopenFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return errClosed
+	}
+	file, err := openAppend(f.path)
+	if err != nil {
+		return err
+	}
+	prev := f.file
+	f.file = file
+	return prev.Close()
+}
+
+// ReopenOnSignal reopens the file each time the process receives one of
+// the signals, or SIGHUP if no signals are specified. Errors reopening the
+// file are passed to onError, if it is not nil. Call the returned function
+// to stop reopening the file on signals.
+//
+//	stop := f.ReopenOnSignal(nil)
+//	defer stop()
+func (f *ReopenFile) ReopenOnSignal(onError func(error), sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := f.Reopen(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// Sync commits the contents of the current file to stable storage.
+func (f *ReopenFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return errClosed
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file.
+func (f *ReopenFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return errClosed
+	}
+	f.closed = true
+	return f.file.Close()
+}
+
+// openAppend opens the file at path for appending, creating
+// the file and its directory if necessary.
+func openAppend(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
@@ -0,0 +1,84 @@
+package logfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+
+	"github.com/spkg/slog"
+)
+
+func TestReopen(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	path := filepath.Join(dir, "sub", "app.log")
+	f, err := NewReopenFile(path)
+	if !assert.NoError(err) {
+		return
+	}
+	f.Write([]byte("first\n"))
+	assert.NoError(os.Rename(path, path+".1"))
+	f.Write([]byte("second\n"))
+	assert.NoError(f.Reopen())
+	f.Write([]byte("third\n"))
+	assert.NoError(f.Sync())
+	assert.NoError(f.Close())
+	assert.Error(f.Reopen())
+
+	b, _ := ioutil.ReadFile(path + ".1")
+	assert.Equal("first\nsecond\n", string(b))
+	b, _ = ioutil.ReadFile(path)
+	assert.Equal("third\n", string(b))
+}
+
+func TestReopenConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	path := filepath.Join(dir, "app.log")
+	f, err := NewReopenFile(path)
+	if !assert.NoError(err) {
+		return
+	}
+	l := slog.New()
+	l.SetOutput(f)
+	text := strings.Repeat("x", 1000)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				l.Info(context.Background(), text, slog.WithValue("i", i))
+			}
+		}(g)
+	}
+	for i := 0; i < 10; i++ {
+		os.Rename(path, fmt.Sprintf("%s.%d", path, i))
+		assert.NoError(f.Reopen())
+	}
+	wg.Wait()
+	assert.NoError(f.Close())
+
+	var lines int
+	names, _ := readDirNames(dir)
+	for _, name := range names {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+			if len(line) > 0 {
+				assert.Contains(string(line), "msg="+text+" i=")
+				lines++
+			}
+		}
+	}
+	assert.Equal(400, lines)
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package logfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReopenOnSignal(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	path := filepath.Join(dir, "app.log")
+	f, err := NewReopenFile(path)
+	if !assert.NoError(err) {
+		return
+	}
+	defer f.Close()
+	stop := f.ReopenOnSignal(func(err error) { t.Error(err) }, syscall.SIGUSR1)
+	defer stop()
+
+	assert.NoError(os.Rename(path, path+".1"))
+	assert.NoError(syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.Write([]byte("after signal\n"))
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal("after signal\n", string(b))
+	stop()
+}
@@ -0,0 +1,373 @@
+// Package logfile provides file writers for log output that manage
+// their own files, for use where no external log collector is available.
+//
+// A RotatingFile rotates the log file by size and time interval, and
+// removes old files. A ReopenFile works with an external log rotation
+// program, and reopens the log file when told to.
+//
+// Both writers are safe for concurrent use, and can be used as the
+// output of a logger or a sink.
+//
+//	f, err := logfile.NewRotatingFile("/var/log/app.log", logfile.Options{
+//		MaxSize:    100 << 20,
+//		MaxBackups: 10,
+//		Compress:   true,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer f.Close()
+//	slog.SetOutput(f)
+package logfile
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveTimeLayout is the layout of the timestamp in archive file names.
+const archiveTimeLayout = "2006-01-02T15-04-05.000"
+
+// compressSuffix is the file name suffix of compressed archives.
+const compressSuffix = ".gz"
+
+var (
+	errClosed = errors.New("logfile: file already closed")
+)
+
+// Options control when a RotatingFile is rotated, and
+// how long rotated files are kept.
+type Options struct {
+	MaxSize    int64         // Rotate before the file exceeds this many bytes, zero means no limit
+	Interval   time.Duration // Rotate at multiples of this interval, eg 24 * time.Hour rotates at midnight; zero means never
+	Compress   bool          // Compress rotated files with gzip in the background
+	MaxBackups int           // Maximum number of rotated files kept, zero means no limit
+	MaxAge     time.Duration // Remove rotated files older than this, zero means no limit
+	LocalTime  bool          // Use local time in archive names and for intervals, default UTC
+}
+
+// RotatingFile is an io.Writer that writes to a file, and rotates the file
+// when it reaches a maximum size, or at a regular interval, or both.
+//
+// When the file is rotated, it is renamed with a timestamp inserted before
+// its extension, eg "app.log" is renamed to "app-2020-01-02T15-04-05.000.log",
+// and a new file is created. If compression is enabled, rotated files are
+// compressed in a background goroutine. Rotated files beyond the maximum
+// number of backups, or older than the maximum age, are removed.
+//
+// Each call to Write is written to a single file, so a log message is never
+// split across files. A RotatingFile is safe for concurrent use.
+type RotatingFile struct {
+	path string
+	opts Options
+	now  func() time.Time // replaced during testing
+
+	mu       sync.Mutex // protects the following fields
+	file     *os.File
+	size     int64
+	rotateAt time.Time // time of the next interval rotation, zero if none
+	closed   bool
+
+	millMu sync.Mutex     // serializes compression and removal of rotated files
+	millWG sync.WaitGroup // background goroutines compressing and removing files
+}
+
+// NewRotatingFile opens the file at path for appending, creating the file
+// and its directory if necessary.
+func NewRotatingFile(path string, opts Options) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path: path,
+		opts: opts,
+		now:  time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	// rotated files may remain uncompressed if the program exited while
+	// compressing, and retention limits may have changed since the last run
+	f.startMill()
+	return f, nil
+}
+
+// Write implements the io.Writer interface. The file is rotated before the
+// write if the write would take it past its maximum size, or if the rotation
+// interval has passed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, errClosed
+	}
+	if f.needsRotate(int64(len(p))) {
+		// if rotation fails but a file is open, write to it rather than
+		// lose the message, and try to rotate again on the next write
+		if err := f.rotate(); err != nil && f.file == nil {
+			return 0, err
+		}
+	} else if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file, renames it, and opens a new file.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return errClosed
+	}
+	return f.rotate()
+}
+
+// Sync commits the contents of the current file to stable storage.
+func (f *RotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return errClosed
+	}
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file, and waits for any background
+// compression of rotated files to finish.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return errClosed
+	}
+	f.closed = true
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+	}
+	f.mu.Unlock()
+	f.millWG.Wait()
+	return err
+}
+
+// needsRotate reports whether the file should be rotated
+// before writing n bytes.
+func (f *RotatingFile) needsRotate(n int64) bool {
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+	return !f.rotateAt.IsZero() && !f.now().Before(f.rotateAt)
+}
+
+// open opens the file at the path for appending.
+func (f *RotatingFile) open() error {
+	file, err := openAppend(f.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	if f.opts.Interval > 0 {
+		// align intervals with the time zone, so that a daily
+		// interval rotates at midnight
+		now := f.timeNow()
+		_, offset := now.Zone()
+		shift := time.Duration(offset) * time.Second
+		f.rotateAt = now.Add(shift).Truncate(f.opts.Interval).Add(f.opts.Interval - shift)
+	}
+	return nil
+}
+
+// rotate renames the current file and opens a new one. The file is
+// nil if it could not be reopened, and is opened by the next write.
+func (f *RotatingFile) rotate() error {
+	var closeErr error
+	if f.file != nil {
+		// the descriptor is released even if closing fails,
+		// so the file is renamed and reopened regardless
+		closeErr = f.file.Close()
+		f.file = nil
+	}
+	if err := os.Rename(f.path, f.archiveName(f.timeNow())); err != nil {
+		// keep writing to the same file rather than lose messages
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.startMill()
+	return closeErr
+}
+
+// timeNow returns the current time in the location used for file names.
+func (f *RotatingFile) timeNow() time.Time {
+	if f.opts.LocalTime {
+		return f.now().Local()
+	}
+	return f.now().UTC()
+}
+
+// prefixAndExt splits the base name of the file into the parts
+// before and after the timestamp in archive names.
+func (f *RotatingFile) prefixAndExt() (prefix, ext string) {
+	base := filepath.Base(f.path)
+	ext = filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// archiveName returns an unused file name for a file rotated at time t.
+func (f *RotatingFile) archiveName(t time.Time) string {
+	prefix, ext := f.prefixAndExt()
+	name := filepath.Join(filepath.Dir(f.path), prefix+t.Format(archiveTimeLayout))
+	archive := name + ext
+	for i := 1; exists(archive) || exists(archive+compressSuffix); i++ {
+		archive = name + "." + strconv.Itoa(i) + ext
+	}
+	return archive
+}
+
+// archive is a rotated file.
+type archive struct {
+	path string
+	t    time.Time
+}
+
+// archives returns the rotated files, newest first.
+func (f *RotatingFile) archives() ([]archive, error) {
+	dir := filepath.Dir(f.path)
+	names, err := readDirNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix, ext := f.prefixAndExt()
+	loc := time.UTC
+	if f.opts.LocalTime {
+		loc = time.Local
+	}
+	var archives []archive
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		if len(stamp) < len(archiveTimeLayout) {
+			continue
+		}
+		rest := strings.TrimSuffix(stamp[len(archiveTimeLayout):], compressSuffix)
+		if !strings.HasSuffix(rest, ext) {
+			continue
+		}
+		t, err := time.ParseInLocation(archiveTimeLayout, stamp[:len(archiveTimeLayout)], loc)
+		if err != nil {
+			continue
+		}
+		archives = append(archives, archive{path: filepath.Join(dir, name), t: t})
+	}
+	sort.SliceStable(archives, func(i, j int) bool {
+		if archives[i].t.Equal(archives[j].t) {
+			return archives[i].path > archives[j].path
+		}
+		return archives[i].t.After(archives[j].t)
+	})
+	return archives, nil
+}
+
+// startMill starts a background goroutine that compresses
+// and removes rotated files.
+func (f *RotatingFile) startMill() {
+	if !f.opts.Compress && f.opts.MaxBackups <= 0 && f.opts.MaxAge <= 0 {
+		return
+	}
+	f.millWG.Add(1)
+	go func() {
+		defer f.millWG.Done()
+		f.mill()
+	}()
+}
+
+// mill removes rotated files that are no longer retained, and compresses
+// the remainder if compression is enabled. Errors are ignored, as there is
+// nowhere to report them; the work is retried after the next rotation.
+func (f *RotatingFile) mill() {
+	f.millMu.Lock()
+	defer f.millMu.Unlock()
+
+	archives, err := f.archives()
+	if err != nil {
+		return
+	}
+	cutoff := f.now().Add(-f.opts.MaxAge)
+	for i, a := range archives {
+		if (f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups) || (f.opts.MaxAge > 0 && a.t.Before(cutoff)) {
+			os.Remove(a.path)
+			continue
+		}
+		if f.opts.Compress && !strings.HasSuffix(a.path, compressSuffix) {
+			compressFile(a.path)
+		}
+	}
+}
+
+// compressFile compresses the file with gzip, and removes the original.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dstPath := path + compressSuffix
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+func readDirNames(dir string) ([]string, error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return d.Readdirnames(-1)
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,222 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	names, err := readDirNames(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fakeNow returns a clock function that advances by a millisecond
+// each time it is called, so that archive names are unique.
+func fakeNow(start time.Time) func() time.Time {
+	var mu sync.Mutex
+	now := start
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(time.Millisecond)
+		return now
+	}
+}
+
+func TestRotateSize(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, Options{MaxSize: 20})
+	if !assert.NoError(err) {
+		return
+	}
+	f.now = fakeNow(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	for i := 0; i < 5; i++ {
+		_, err := f.Write([]byte(fmt.Sprintf("message %d\n", i)))
+		assert.NoError(err)
+	}
+	assert.NoError(f.Close())
+
+	assert.Equal([]string{
+		"app-2020-01-02T03-04-05.001.log",
+		"app-2020-01-02T03-04-05.002.log",
+		"app.log",
+	}, dirNames(t, dir))
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "app-2020-01-02T03-04-05.001.log"))
+	assert.Equal("message 0\nmessage 1\n", string(b))
+	b, _ = ioutil.ReadFile(path)
+	assert.Equal("message 4\n", string(b))
+
+	_, err = f.Write([]byte("closed"))
+	assert.Error(err)
+}
+
+func TestRotateInterval(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	path := filepath.Join(dir, "app")
+	now := time.Date(2020, 1, 2, 23, 59, 0, 0, time.UTC)
+	f, err := NewRotatingFile(path, Options{Interval: 24 * time.Hour})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(time.Now().UTC().Truncate(24*time.Hour).Add(24*time.Hour), f.rotateAt)
+
+	// next rotation at midnight
+	f.now = func() time.Time { return now }
+	f.rotateAt = time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)
+	f.Write([]byte("day 1\n"))
+	now = now.Add(2 * time.Minute)
+	f.Write([]byte("day 2\n"))
+	f.Write([]byte("day 2\n"))
+	assert.NoError(f.Close())
+
+	assert.Equal([]string{"app", "app-2020-01-03T00-01-00.000"}, dirNames(t, dir))
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal("day 2\nday 2\n", string(b))
+}
+
+func TestRotateErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, Options{})
+	if !assert.NoError(err) {
+		return
+	}
+	f.now = fakeNow(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	defer f.Close()
+
+	// closing the file fails, but the file is still rotated
+	_, err = f.Write([]byte("one\n"))
+	assert.NoError(err)
+	f.file.Close()
+	assert.Error(f.Rotate())
+	_, err = f.Write([]byte("two\n"))
+	assert.NoError(err)
+	assert.Equal([]string{"app-2020-01-02T03-04-05.001.log", "app.log"}, dirNames(t, dir))
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal("two\n", string(b))
+
+	// the file cannot be reopened, so it is opened by the next write
+	sub := filepath.Join(dir, "sub")
+	f2, err := NewRotatingFile(filepath.Join(sub, "app.log"), Options{})
+	if !assert.NoError(err) {
+		return
+	}
+	defer f2.Close()
+	f2.file.Close()
+	assert.NoError(os.RemoveAll(sub))
+	assert.NoError(ioutil.WriteFile(sub, nil, 0644))
+	assert.Error(f2.Rotate())
+	_, err = f2.Write([]byte("lost\n"))
+	assert.Error(err)
+	assert.NoError(os.Remove(sub))
+	_, err = f2.Write([]byte("three\n"))
+	assert.NoError(err)
+	b, _ = ioutil.ReadFile(filepath.Join(sub, "app.log"))
+	assert.Equal("three\n", string(b))
+}
+
+func TestRotateRetention(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	path := filepath.Join(dir, "app.log")
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// an old archive that exceeds the maximum age
+	old := filepath.Join(dir, "app-2019-01-01T00-00-00.000.log")
+	assert.NoError(ioutil.WriteFile(old, []byte("old\n"), 0644))
+	// files that are not archives are left alone
+	other := filepath.Join(dir, "app-other.log")
+	assert.NoError(ioutil.WriteFile(other, []byte("other\n"), 0644))
+
+	f, err := NewRotatingFile(path, Options{MaxBackups: 2, MaxAge: 24 * time.Hour, Compress: true})
+	if !assert.NoError(err) {
+		return
+	}
+	f.millWG.Wait()
+	f.now = fakeNow(start)
+	for i := 0; i < 4; i++ {
+		f.Write([]byte(fmt.Sprintf("message %d\n", i)))
+		assert.NoError(f.Rotate())
+	}
+	assert.NoError(f.Close())
+
+	assert.Equal([]string{
+		"app-2020-01-02T03-04-05.003.log.gz",
+		"app-2020-01-02T03-04-05.004.log.gz",
+		"app-other.log",
+		"app.log",
+	}, dirNames(t, dir))
+
+	file, err := os.Open(filepath.Join(dir, "app-2020-01-02T03-04-05.004.log.gz"))
+	if assert.NoError(err) {
+		defer file.Close()
+		zr, err := gzip.NewReader(file)
+		if assert.NoError(err) {
+			b, _ := ioutil.ReadAll(zr)
+			assert.Equal("message 3\n", string(b))
+		}
+	}
+}
+
+func TestRotateConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, Options{MaxSize: 1000})
+	if !assert.NoError(err) {
+		return
+	}
+	f.now = fakeNow(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				f.Write([]byte(fmt.Sprintf("goroutine %d message %03d\n", g, i)))
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.NoError(f.Close())
+
+	var lines int
+	for _, name := range dirNames(t, dir) {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.True(len(b) <= 1000)
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			assert.Len(line, len("goroutine 0 message 000"))
+			lines++
+		}
+	}
+	assert.Equal(400, lines)
+}
@@ -13,7 +13,13 @@ import (
 )
 
 var (
-	// TimeFormat is the time format used for timestamps.
+	// TimeFormat is the time format used for timestamps, and for
+	// time.Time property values unless the Buffer's FormatTime
+	// function is set.
+	//
+	// TimeFormat is shared by all buffers, and must not be changed while
+	// other goroutines are writing to buffers. The slog formatters have
+	// their own time formats, which are safer to configure.
 	TimeFormat = "2006-01-02T15:04:05.000000-0700"
 )
 
@@ -37,6 +43,10 @@ func init() {
 // the buffer because then internal buffers can be re-used to take pressure off
 // the garbage collector.
 type Buffer struct {
+	// FormatTime formats time.Time property values. If nil,
+	// values are formatted using TimeFormat.
+	FormatTime func(t time.Time) string
+
 	buf *bytes.Buffer
 }
 
@@ -72,7 +82,7 @@ func (b *Buffer) WriteTo(w io.Writer) (int64, error) {
 }
 
 // WriteTimestamp writes a timestamp to the buffer. The format of the timestamp
-// is determined by the TimestampFormat variable.
+// is determined by the TimeFormat variable.
 func (b *Buffer) WriteTimestamp(t time.Time) error {
 	b.allocate()
 	if err := b.spacer(); err != nil {
@@ -93,6 +103,17 @@ func (b *Buffer) WriteKey(key string) error {
 	return err
 }
 
+// WriteValue writes a single value without a key to the buffer. If the value
+// contains any special characters it will be quoted. This is useful for
+// writing timestamps in a format other than TimeFormat.
+func (b *Buffer) WriteValue(value string) error {
+	b.allocate()
+	if err := b.spacer(); err != nil {
+		return err
+	}
+	return writeValueString(b.buf, value)
+}
+
 // WriteProperty writes a key value pair to the buffer. If the value contains any special
 // characters it will be quoted.
 func (b *Buffer) WriteProperty(key string, value interface{}) error {
@@ -100,7 +121,7 @@ func (b *Buffer) WriteProperty(key string, value interface{}) error {
 	if err := b.spacer(); err != nil {
 		return err
 	}
-	return writeProperty(b.buf, key, value)
+	return writeProperty(b.buf, key, value, b.FormatTime)
 }
 
 // allocate ensures that a buffer is allocated.
@@ -217,7 +238,8 @@ func writeValueString(buf *bytes.Buffer, value string) error {
 }
 
 // writeProperty writes a key value pair to buf in a format compatible with logfmt.
-func writeProperty(buf *bytes.Buffer, key string, value interface{}) error {
+// Time values are formatted with formatTime, or TimeFormat if formatTime is nil.
+func writeProperty(buf *bytes.Buffer, key string, value interface{}, formatTime func(time.Time) string) error {
 	var err error
 	_, err = buf.WriteString(key)
 	if err != nil {
@@ -264,6 +286,9 @@ func writeProperty(buf *bytes.Buffer, key string, value interface{}) error {
 	case string:
 		return writeValueString(buf, v)
 	case time.Time:
+		if formatTime != nil {
+			return writeValueString(buf, formatTime(v))
+		}
 		return writeValueString(buf, v.Format(TimeFormat))
 	case uint:
 		_, err = fmt.Fprint(buf, v)
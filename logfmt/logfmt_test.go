@@ -121,6 +121,19 @@ func TestFormatting(t *testing.T) {
 	}
 }
 
+func TestFormatTime(t *testing.T) {
+	assert := assert.New(t)
+	buf := Buffer{
+		FormatTime: func(t time.Time) string { return t.UTC().Format(time.Kitchen) },
+	}
+	defer buf.Reset()
+	ts := time.Date(2016, 11, 30, 12, 30, 28, 0, time.FixedZone("EST", -5*3600))
+	buf.WriteValue("2016-11-30 12:30:28")
+	buf.WriteKey("info")
+	buf.WriteProperty("key", ts)
+	assert.Equal(`"2016-11-30 12:30:28" info key=5:30PM`, buf.String())
+}
+
 func TestNewLine(t *testing.T) {
 	assert := assert.New(t)
 	buf := Buffer{}
@@ -4,74 +4,159 @@ import (
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/net/context"
 )
 
 // Logger is an interface for logging.
 type Logger interface {
+	Trace(ctx context.Context, text string, opts ...Option) *Message
 	Debug(ctx context.Context, text string, opts ...Option) *Message
 	Info(ctx context.Context, text string, opts ...Option) *Message
 	Warn(ctx context.Context, text string, opts ...Option) *Message
 	Error(ctx context.Context, text string, opts ...Option) *Message
+	Fatal(ctx context.Context, text string, opts ...Option)
+	Log(ctx context.Context, level Level, text string, opts ...Option) *Message
 
 	NewWriter(ctx context.Context) io.Writer
 	SetOutput(w io.Writer)
+	SetFormatter(f Formatter)
+	SetSinks(sinks ...Sink)
+	AddSink(s Sink)
 	SetMinLevel(level Level)
-	AddHandler(h Handler)
+	SetLevelVar(v *LevelVar)
+	LevelVar() *LevelVar
+	SetExitCode(code int)
+	SetClock(c Clock)
+	AddHandler(h Handler) *HandlerRegistration
+	AddLevelHandler(h Handler, minLevel, maxLevel Level) *HandlerRegistration
+	ReplaceHandlers(handlers ...Handler)
+	Flush() error
 }
 
 // Handler is an interface for message handlers. A message
 // handler is added to a Logger to perform arbitrary process
 // of log messages.
+//
+// Handle is called without holding any of the logger's locks, so it may
+// be called concurrently from multiple goroutines, and handlers must be
+// safe for concurrent use. A handler may log messages, which are passed
+// to the logger's handlers in turn, including the handler itself.
 type Handler interface {
 	Handle(msgs []*Message)
 }
 
+// Flusher is an interface implemented by handlers and output writers
+// that buffer messages. When a Logger is flushed, it calls the Flush
+// method of its output and each of its handlers, if implemented.
+type Flusher interface {
+	Flush() error
+}
+
+// syncer is implemented by *os.File, which is flushed by calling Sync.
+type syncer interface {
+	Sync() error
+}
+
+// exit is called after a fatal message is logged. Replaced during testing.
+var exit = os.Exit
+
 type loggerImpl struct {
-	mu       sync.Mutex // ensures atomic writes; protects the following fields
-	out      io.Writer  // destination for output
-	handlers []Handler  // list of handlers
-	minLevel Level      // minimum level to log
+	name     string       // name of a named logger, empty for other loggers
+	level    atomic.Value // *LevelVar: minimum level to log, nil to inherit; not protected by mu
+	clock    atomic.Value // clockValue: clock for timestamps, nil to inherit; not protected by mu
+	mu       sync.Mutex   // ensures atomic writes; protects the following fields
+	out      io.Writer    // destination for output
+	format   Formatter    // format of output, logfmt if nil
+	sinks    []Sink       // additional outputs
+	handlers handlerList  // list of handlers, copied on write
+	exitCode int          // exit code for fatal messages
+
+	// calls counts the calls to handlers in progress. ApplyConfig replaces
+	// it, and waits for the calls counted by the previous one to return
+	// before closing the handlers of the previous configuration.
+	calls *sync.WaitGroup
+
+	configClosers  []io.Closer // files opened by ApplyConfig
+	configLoggers  []string    // named loggers configured by ApplyConfig
+	configHandlers handlerList // handlers created by ApplyConfig
 }
 
 // New returns a new Logger with default settings. Writes to stdout, and
 // does not print debug messages.
 func New() Logger {
-	return &loggerImpl{
+	l := &loggerImpl{
 		// NOTE: differs from std logging in that default is standard output
 		// not standard error. This is consistent with 12 factor app, but
 		// is it the appropriate default.
 		out:      os.Stdout,
-		minLevel: LevelInfo,
+		exitCode: 1,
+		calls:    new(sync.WaitGroup),
 	}
+	l.level.Store(NewLevelVar(LevelInfo))
+	return l
+}
+
+func (l *loggerImpl) Trace(ctx context.Context, text string, opts ...Option) *Message {
+	m := newMessage(ctx, l.now(), LevelTrace, text)
+	m.applyOpts(opts)
+	l.output(ctx, m)
+	return m
 }
 
 func (l *loggerImpl) Debug(ctx context.Context, text string, opts ...Option) *Message {
-	m := newMessage(ctx, LevelDebug, text)
+	m := newMessage(ctx, l.now(), LevelDebug, text)
 	m.applyOpts(opts)
-	l.output(m)
+	l.output(ctx, m)
 	return m
 }
 
 func (l *loggerImpl) Info(ctx context.Context, text string, opts ...Option) *Message {
-	m := newMessage(ctx, LevelInfo, text)
+	m := newMessage(ctx, l.now(), LevelInfo, text)
 	m.applyOpts(opts)
-	l.output(m)
+	l.output(ctx, m)
 	return m
 }
 
 func (l *loggerImpl) Warn(ctx context.Context, text string, opts ...Option) *Message {
-	m := newMessage(ctx, LevelWarning, text)
+	m := newMessage(ctx, l.now(), LevelWarning, text)
 	m.applyOpts(opts)
-	l.output(m)
+	l.output(ctx, m)
 	return m
 }
 
 func (l *loggerImpl) Error(ctx context.Context, text string, opts ...Option) *Message {
-	m := newMessage(ctx, LevelError, text)
+	m := newMessage(ctx, l.now(), LevelError, text)
 	m.applyOpts(opts)
-	l.output(m)
+	l.output(ctx, m)
+	return m
+}
+
+// Fatal logs the message, flushes the output and all handlers, and then
+// exits the program with the logger's exit code.
+func (l *loggerImpl) Fatal(ctx context.Context, text string, opts ...Option) {
+	m := newMessage(ctx, l.now(), LevelFatal, text)
+	m.applyOpts(opts)
+	l.output(ctx, m)
+	l.Flush()
+	if p := l.parent(); p != nil {
+		p.Flush()
+	}
+
+	l.mu.Lock()
+	code := l.exitCode
+	l.mu.Unlock()
+	exit(code)
+}
+
+// Log logs a message at any level, including custom levels registered
+// using RegisterLevel. Logging a message at LevelFatal using Log does
+// not exit the program.
+func (l *loggerImpl) Log(ctx context.Context, level Level, text string, opts ...Option) *Message {
+	m := newMessage(ctx, l.now(), level, text)
+	m.applyOpts(opts)
+	l.output(ctx, m)
 	return m
 }
 
@@ -82,10 +167,50 @@ func (l *loggerImpl) NewWriter(ctx context.Context) io.Writer {
 	}
 }
 
+// SetMinLevel sets the value of the logger's LevelVar. If the LevelVar is
+// shared with other loggers, their minimum level changes too. A named logger
+// that inherits its minimum level is given its own LevelVar.
 func (l *loggerImpl) SetMinLevel(level Level) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.minLevel = level
+	if l.name != "" {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.inheritsLevel() {
+			l.level.Store(NewLevelVar(level))
+			return
+		}
+	}
+	l.LevelVar().Set(level)
+}
+
+// SetLevelVar replaces the logger's LevelVar, which determines
+// its minimum level. A LevelVar can be shared by multiple loggers.
+// Setting a nil LevelVar on a named logger causes it to inherit the
+// minimum level of the default logger.
+func (l *loggerImpl) SetLevelVar(v *LevelVar) {
+	if v == nil && l.name == "" {
+		v = NewLevelVar(LevelInfo)
+	}
+	l.level.Store(v)
+}
+
+// LevelVar returns the LevelVar that determines the logger's minimum level.
+// A named logger without its own LevelVar returns the LevelVar of the
+// default logger.
+func (l *loggerImpl) LevelVar() *LevelVar {
+	if v, _ := l.level.Load().(*LevelVar); v != nil {
+		return v
+	}
+	if p := l.parent(); p != nil {
+		return p.LevelVar()
+	}
+	return NewLevelVar(LevelInfo)
+}
+
+// inheritsLevel reports whether a named logger inherits its
+// minimum level from the default logger.
+func (l *loggerImpl) inheritsLevel() bool {
+	v, _ := l.level.Load().(*LevelVar)
+	return v == nil && l.name != ""
 }
 
 func (l *loggerImpl) SetOutput(w io.Writer) {
@@ -94,35 +219,176 @@ func (l *loggerImpl) SetOutput(w io.Writer) {
 	l.out = w
 }
 
-func (l *loggerImpl) AddHandler(h Handler) {
+// SetFormatter sets the format of messages written to the output.
+// Setting a nil formatter restores the default logfmt format.
+func (l *loggerImpl) SetFormatter(f Formatter) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.handlers = append(l.handlers, h)
+	l.format = f
 }
 
-// output provides the common functionality to output a message.
-func (l *loggerImpl) output(m *Message) {
-	// TODO: if out is a tty, use ansi sequences to print color-coded output.
-	// For now, just always write to the output using logfmt format.
+// SetSinks replaces the logger's additional outputs. Messages are written
+// to each sink as well as to the output set by SetOutput. Call SetOutput(nil)
+// to write only to the sinks.
+func (l *loggerImpl) SetSinks(sinks ...Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sinks = append([]Sink(nil), sinks...)
+}
+
+// AddSink appends an additional output to the logger.
+func (l *loggerImpl) AddSink(s Sink) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	l.sinks = append(l.sinks, s)
+}
+
+func (l *loggerImpl) SetExitCode(code int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.exitCode = code
+}
 
-	if m.Level >= l.minLevel {
-		if l.out != nil {
-			buf := m.logfmtBuffer()
-			buf.WriteEOL()
-			buf.WriteTo(l.out)
-			buf.Reset()
+// AddHandler appends a handler that receives all messages that have passed
+// the logger's minimum level. The returned registration can be used to
+// remove the handler.
+func (l *loggerImpl) AddHandler(h Handler) *HandlerRegistration {
+	return l.AddLevelHandler(h, 0, 0)
+}
+
+// AddLevelHandler appends a handler that only receives messages with
+// levels between minLevel and maxLevel inclusive. A zero minLevel or
+// maxLevel means no minimum or maximum respectively. The handler only
+// receives messages that have passed the logger's minimum level.
+func (l *loggerImpl) AddLevelHandler(h Handler, minLevel, maxLevel Level) *HandlerRegistration {
+	e := &handlerEntry{
+		handler:  h,
+		minLevel: minLevel,
+		maxLevel: maxLevel,
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers = l.handlers.add(e)
+	return &HandlerRegistration{logger: l, entry: e}
+}
+
+// ReplaceHandlers replaces all of the logger's handlers. Calling
+// ReplaceHandlers with no arguments removes all handlers.
+func (l *loggerImpl) ReplaceHandlers(handlers ...Handler) {
+	var list handlerList
+	for _, h := range handlers {
+		list = list.add(&handlerEntry{handler: h})
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers = list
+}
+
+// removeHandler removes the handler entry if it is still in the list.
+func (l *loggerImpl) removeHandler(e *handlerEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers = l.handlers.remove(e)
+}
+
+// Flush flushes the output and any handlers that implement the Flusher
+// interface. Returns the first error encountered.
+//
+// Handlers are flushed without holding the logger's lock, so a handler
+// can log messages while it is being flushed.
+func (l *loggerImpl) Flush() error {
+	var firstErr error
+	setErr := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
 		}
+	}
+
+	l.mu.Lock()
+	if l.out != nil {
+		setErr(flushWriter(l.out))
+	}
+	for _, s := range l.sinks {
+		if s.Writer != nil {
+			setErr(flushWriter(s.Writer))
+		}
+	}
+	handlers, calls := l.handlers, l.calls
+	calls.Add(1)
+	l.mu.Unlock()
+	defer calls.Done()
+
+	for _, e := range handlers {
+		setErr(flushHandler(e.handler))
+	}
+
+	return firstErr
+}
+
+// enabled reports whether a message at level should be logged. A minimum
+// level associated with the context overrides the logger's minimum level.
+func (l *loggerImpl) enabled(ctx context.Context, level Level) bool {
+	if level.always() {
+		return true
+	}
+	minLevel, ok := minLevelFromContext(ctx)
+	if !ok {
+		minLevel = l.LevelVar().Level()
+	}
+	return level >= minLevel
+}
+
+// output provides the common functionality to output a message.
+func (l *loggerImpl) output(ctx context.Context, m *Message) {
+	// TODO: if out is a tty, use ansi sequences to print color-coded output.
+	m.Logger = l.name
+	enabled := l.enabled(ctx, m.Level)
+	if buf := bufferFromContext(ctx); buf != nil {
+		buf.output(l, m, enabled)
+		return
+	}
+	if enabled {
+		l.publish(m)
+	}
+}
+
+// publish emits the message to the logger and its parent.
+func (l *loggerImpl) publish(m *Message) {
+	l.emit(m)
+
+	// messages logged to a named logger are also output by the default logger
+	if p := l.parent(); p != nil {
+		p.emit(m)
+	}
+}
+
+// emit writes the message to the output and sends it to each
+// handler. The caller has already checked the message level.
+func (l *loggerImpl) emit(m *Message) {
+	l.mu.Lock()
+	if l.out != nil {
+		formatMessage(l.out, l.format, m)
+	}
+	for i := range l.sinks {
+		l.sinks[i].write(m)
+	}
+	// the handler list is never modified in place, so the handlers are
+	// called after releasing the lock, which allows handlers to log
+	// messages, and to add or remove handlers, without deadlocking
+	handlers, calls := l.handlers, l.calls
+	calls.Add(1)
+	l.mu.Unlock()
+	defer calls.Done()
 
-		// TODO: could reduce locking here by having a goroutine and a buffered
-		// channel for each handler. The goroutine could read from the buffered
-		// channel and group messages into a slice and send the slice to the
-		// handler. This is why the Handler type accepts a slice of messages.
-		// For now, the implementation is simple.
-		messages := []*Message{m}
-		for _, handler := range l.handlers {
-			handler.Handle(messages)
+	// TODO: could reduce locking here by having a goroutine and a buffered
+	// channel for each handler. The goroutine could read from the buffered
+	// channel and group messages into a slice and send the slice to the
+	// handler. This is why the Handler type accepts a slice of messages.
+	// For now, the implementation is simple.
+	messages := []*Message{m}
+	for _, e := range handlers {
+		if inLevelRange(m.Level, e.minLevel, e.maxLevel) {
+			e.handler.Handle(messages)
 		}
 	}
 }
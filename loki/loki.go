@@ -0,0 +1,519 @@
+// Package loki provides a slog handler that pushes messages to Grafana Loki.
+//
+//	h, err := loki.New(loki.Config{
+//		URL:          "http://loki.example.com:3100",
+//		Labels:       []string{"service", "region"},
+//		StaticLabels: map[string]string{"job": "myapp"},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer h.Close()
+//	slog.AddHandler(h)
+//
+// Each message is sent to the stream identified by its labels: the level,
+// the static labels, and the properties and context values whose keys are
+// in the configured list of labels. Labels should have few distinct values,
+// as Loki indexes each stream. The rest of the message is the log line, in
+// logfmt format, including the properties that are not used as labels
+// because their value is empty or their label is already set:
+//
+//	msg="disk almost full" logger=storage path=/data code=DISK
+//
+// Push requests are sent in JSON format, unless the protobuf encoding is
+// configured, which is smaller but compresses requests with Snappy.
+//
+// The package registers the "loki" handler type for use in a slog.Config,
+// with a Config in JSON format as its parameters. Durations in the
+// parameters are strings such as "5s".
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/batch"
+	"github.com/spkg/slog/internal/handlerfmt"
+	"github.com/spkg/slog/internal/jsonconfig"
+	"github.com/spkg/slog/logfmt"
+)
+
+// Encodings of push requests.
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf" // Snappy-compressed protocol buffers
+)
+
+// Defaults for the configuration.
+const (
+	DefaultBatchSize     = 1000
+	DefaultFlushInterval = batch.DefaultFlushInterval
+	DefaultQueueSize     = batch.DefaultQueueSize
+	DefaultMaxRetries    = 5
+	DefaultMinBackoff    = batch.DefaultMinBackoff
+	DefaultMaxBackoff    = batch.DefaultMaxBackoff
+	DefaultFlushTimeout  = batch.DefaultFlushTimeout
+	DefaultTimeout       = 10 * time.Second
+)
+
+// pushPath is the path of the push API.
+const pushPath = "/loki/api/v1/push"
+
+// levelLabel is the name of the label for the message level.
+const levelLabel = "level"
+
+// streamTTL is how long the latest timestamp of a stream is kept after
+// the stream was last sent an entry, measured by message timestamps.
+const streamTTL = time.Hour
+
+var (
+	errNoURL           = errors.New("loki: no URL")
+	errUnknownEncoding = errors.New("loki: unknown encoding")
+	errLevelLabel      = errors.New("loki: static label \"level\" is reserved for the message level")
+)
+
+// Config describes the Loki server, the labels of streams,
+// and how batches are sent.
+type Config struct {
+	URL           string            `json:"url"`                      // Base URL of the server
+	Encoding      string            `json:"encoding,omitempty"`       // EncodingJSON (default) or EncodingProtobuf
+	Labels        []string          `json:"labels,omitempty"`         // Property and context keys that are labels
+	StaticLabels  map[string]string `json:"static_labels,omitempty"`  // Labels added to every stream, with valid names other than "level"
+	TenantID      string            `json:"tenant_id,omitempty"`      // X-Scope-OrgID header, omitted if empty
+	Username      string            `json:"username,omitempty"`       // Basic authentication user
+	Password      string            `json:"password,omitempty"`       // Basic authentication password
+	Headers       map[string]string `json:"headers,omitempty"`        // Added to each request
+	BatchSize     int               `json:"batch_size,omitempty"`     // Maximum messages per request
+	FlushInterval time.Duration     `json:"flush_interval,omitempty"` // Maximum time a message waits before it is sent
+	QueueSize     int               `json:"queue_size,omitempty"`     // Maximum messages waiting to be sent
+	MaxRetries    int               `json:"max_retries,omitempty"`    // Retries of a failed request; negative for none
+	MinBackoff    time.Duration     `json:"min_backoff,omitempty"`    // Delay before the first retry
+	MaxBackoff    time.Duration     `json:"max_backoff,omitempty"`    // Maximum delay between retries
+	FlushTimeout  time.Duration     `json:"flush_timeout,omitempty"`  // Maximum time Flush and Close wait for batches to be sent
+	Timeout       time.Duration     `json:"timeout,omitempty"`        // Timeout of each request
+
+	// Client sends the requests. If nil, a client with
+	// the configured timeout is used.
+	Client *http.Client `json:"-"`
+
+	// OnError, if not nil, is called with the error when a batch
+	// is discarded because it could not be sent. It is called from a
+	// separate goroutine, and may log the error to a logger that uses
+	// the handler, but must not close the handler.
+	OnError func(error) `json:"-"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface,
+// parsing durations with time.ParseDuration.
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type config Config
+	return jsonconfig.Unmarshal(b, (*config)(c), "flush_interval", "min_backoff", "max_backoff", "flush_timeout", "timeout")
+}
+
+// StatusError is the error for a push request that failed
+// with an unsuccessful HTTP status.
+type StatusError = batch.StatusError
+
+// Handler is a slog.Handler that queues messages and pushes them to Loki
+// in batches.
+//
+// A batch is sent when it reaches the batch size, or when the flush interval
+// has passed. Batches are sent one at a time, so that each stream receives
+// its entries in order. Loki rejects entries older than the latest entry in
+// their stream, so an entry with an earlier timestamp than the last entry
+// sent to its stream is sent with the timestamp of that entry instead. The
+// latest timestamp of a stream is forgotten once a batch has been sent with
+// entries more than an hour later, so that streams that are no longer used
+// do not accumulate.
+//
+// Requests that fail because of a network error or a 5xx or 429 status are
+// retried with exponential backoff and jitter. A delay given by the
+// Retry-After header of the response is honored, up to the maximum backoff.
+// Batches that cannot be sent are discarded.
+//
+// When the queue is full, the oldest message is dropped.
+// A Handler is safe for concurrent use.
+type Handler struct {
+	config Config
+	labels map[string]string // label name for each property key
+	queue  *batch.Queue
+
+	latest map[string]time.Time // latest timestamp sent to each stream, used by send
+}
+
+func init() {
+	slog.RegisterHandlerFactory("loki", func(params json.RawMessage) (slog.Handler, error) {
+		var c Config
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &c); err != nil {
+				return nil, err
+			}
+		}
+		return New(c)
+	})
+}
+
+// New returns a handler that pushes messages to the server described by
+// the configuration. It starts a goroutine that sends the batches, which
+// stops when the handler is closed.
+func New(c Config) (*Handler, error) {
+	if c.URL == "" {
+		return nil, errNoURL
+	}
+	c.URL = strings.TrimSuffix(c.URL, "/")
+	switch c.Encoding {
+	case "":
+		c.Encoding = EncodingJSON
+	case EncodingJSON, EncodingProtobuf:
+	default:
+		return nil, errUnknownEncoding
+	}
+	for name := range c.StaticLabels {
+		if name == levelLabel {
+			return nil, errLevelLabel
+		}
+		if LabelName(name) != name {
+			return nil, fmt.Errorf("loki: invalid static label name %q", name)
+		}
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = DefaultMaxRetries
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: c.Timeout}
+	}
+	h := &Handler{
+		config: c,
+		labels: make(map[string]string),
+		latest: make(map[string]time.Time),
+	}
+	for _, key := range c.Labels {
+		if name := LabelName(key); name != "" {
+			h.labels[key] = name
+		}
+	}
+	h.queue = batch.New(batch.Options{
+		Name:          "loki",
+		BatchSize:     c.BatchSize,
+		FlushInterval: c.FlushInterval,
+		QueueSize:     c.QueueSize,
+		MaxRetries:    c.MaxRetries,
+		MinBackoff:    c.MinBackoff,
+		MaxBackoff:    c.MaxBackoff,
+		FlushTimeout:  c.FlushTimeout,
+		Send:          h.send,
+		OnError:       c.OnError,
+	})
+	return h, nil
+}
+
+// Handle implements the slog.Handler interface.
+func (h *Handler) Handle(msgs []*slog.Message) {
+	h.queue.Handle(msgs)
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (h *Handler) Dropped() int64 {
+	return h.queue.Dropped()
+}
+
+// Flush implements the slog.Flusher interface. It sends all queued messages
+// and returns the error of the last batch that could not be sent, if any.
+// If the batches have not been sent within the flush timeout, Flush returns
+// an error while they continue to be sent.
+func (h *Handler) Flush() error {
+	return h.queue.Flush()
+}
+
+// Close sends all queued messages and stops the handler. Messages
+// handled after Close are discarded. If the messages have not been sent
+// within the flush timeout, failed requests are not retried, and the
+// messages still queued are discarded.
+func (h *Handler) Close() error {
+	return h.queue.Close()
+}
+
+// send pushes a batch, retrying if the request fails
+// with an error that may be temporary.
+func (h *Handler) send(msgs []*slog.Message) error {
+	streams := h.streams(msgs)
+	var body []byte
+	var err error
+	if h.config.Encoding == EncodingJSON {
+		body, err = encodeJSON(streams)
+	} else {
+		body = snappy.Encode(nil, encodeProtobuf(streams))
+	}
+	if err == nil {
+		_, err = h.queue.Retry(func() (time.Duration, error) {
+			return h.post(body)
+		})
+	}
+	if err != nil {
+		h.queue.Discard(err)
+	}
+	return err
+}
+
+// post sends a push request with the body. If the request fails and can be
+// retried, it returns the delay requested by the server, which is zero
+// if none was given. If the request cannot be retried, the delay is negative.
+func (h *Handler) post(body []byte) (time.Duration, error) {
+	req, err := http.NewRequest("POST", h.config.URL+pushPath, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	if h.config.Encoding == EncodingJSON {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	if h.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", h.config.TenantID)
+	}
+	if h.config.Username != "" {
+		req.SetBasicAuth(h.config.Username, h.config.Password)
+	}
+	for k, v := range h.config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.config.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if wait, err := h.queue.CheckStatus(resp); err != nil {
+		return wait, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return 0, nil
+}
+
+// stream is the entries of a batch that have the same labels.
+type stream struct {
+	labels  string // in Loki's format, such as {job="app", level="info"}
+	label   map[string]string
+	entries []entry
+}
+
+type entry struct {
+	timestamp time.Time
+	line      string
+}
+
+// streams groups the messages in a batch into streams, in order of
+// their first message. The entries in each stream are sorted by timestamp,
+// and are no earlier than the latest entry previously sent to the stream.
+// Streams whose latest entry is older than the batch by more than the
+// stream TTL are forgotten.
+func (h *Handler) streams(msgs []*slog.Message) []*stream {
+	var streams []*stream
+	var newest time.Time
+	byLabels := make(map[string]*stream)
+	for _, m := range msgs {
+		label, line := h.labelsAndLine(m)
+		labels := formatLabels(label)
+		s := byLabels[labels]
+		if s == nil {
+			s = &stream{labels: labels, label: label}
+			byLabels[labels] = s
+			streams = append(streams, s)
+		}
+		s.entries = append(s.entries, entry{timestamp: m.Timestamp, line: line})
+	}
+	for _, s := range streams {
+		sort.SliceStable(s.entries, func(i, j int) bool {
+			return s.entries[i].timestamp.Before(s.entries[j].timestamp)
+		})
+		latest := h.latest[s.labels]
+		for i := range s.entries {
+			if s.entries[i].timestamp.Before(latest) {
+				s.entries[i].timestamp = latest
+			}
+		}
+		last := s.entries[len(s.entries)-1].timestamp
+		h.latest[s.labels] = last
+		if last.After(newest) {
+			newest = last
+		}
+	}
+	expired := newest.Add(-streamTTL)
+	for labels, latest := range h.latest {
+		if latest.Before(expired) {
+			delete(h.latest, labels)
+		}
+	}
+	return streams
+}
+
+// labelsAndLine returns the labels of the stream for a message, and its
+// log line in logfmt format, which contains the properties that are not
+// used as labels.
+func (h *Handler) labelsAndLine(m *slog.Message) (map[string]string, string) {
+	label := map[string]string{levelLabel: m.Level.String()}
+	for k, v := range h.config.StaticLabels {
+		label[k] = v
+	}
+
+	var buf logfmt.Buffer
+	defer buf.Reset()
+	buf.WriteProperty("msg", m.Text)
+	if m.Logger != "" {
+		buf.WriteProperty("logger", m.Logger)
+	}
+	if m.Err != nil {
+		buf.WriteProperty("error", m.Err.Error())
+	}
+	for _, props := range [][]slog.Property{m.Properties, m.Context} {
+		for _, p := range props {
+			if name, ok := h.labels[p.Key]; ok {
+				// Loki treats an empty label value as no label
+				if _, exists := label[name]; !exists {
+					if value := handlerfmt.Value(p.Value); value != "" {
+						label[name] = value
+						continue
+					}
+				}
+			}
+			buf.WriteProperty(p.Key, p.Value)
+		}
+	}
+	if code := m.Code(); code != "" {
+		buf.WriteProperty("code", code)
+	}
+	if m.Status() != 0 {
+		buf.WriteProperty("status", m.Status())
+	}
+	return label, buf.String()
+}
+
+// formatLabels returns labels in Loki's format, sorted by name.
+func formatLabels(label map[string]string) string {
+	names := make([]string, 0, len(label))
+	for name := range label {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(label[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// LabelName returns the label name for a property key. Characters other
+// than letters, digits and underscores are replaced with underscores, and
+// an underscore is added before a leading digit.
+func LabelName(key string) string {
+	if key == "" {
+		return ""
+	}
+	b := make([]byte, 0, len(key)+1)
+	if key[0] >= '0' && key[0] <= '9' {
+		b = append(b, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// encodeJSON returns a push request in JSON format.
+func encodeJSON(streams []*stream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	req := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+	for _, s := range streams {
+		js := jsonStream{Stream: s.label}
+		for _, e := range s.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(e.timestamp.UnixNano(), 10), e.line})
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
+
+// encodeProtobuf returns a push request as an uncompressed logproto.PushRequest
+// protocol buffer message:
+//
+//	message PushRequest { repeated Stream streams = 1; }
+//	message Stream { string labels = 1; repeated Entry entries = 2; }
+//	message Entry { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+//	message Timestamp { int64 seconds = 1; int32 nanos = 2; }
+func encodeProtobuf(streams []*stream) []byte {
+	var req, s, e, ts []byte
+	for _, st := range streams {
+		s = appendBytes(s[:0], 1, []byte(st.labels))
+		for _, en := range st.entries {
+			ts = ts[:0]
+			if secs := en.timestamp.Unix(); secs != 0 {
+				ts = appendVarint(appendTag(ts, 1, wireVarint), uint64(secs))
+			}
+			if nanos := en.timestamp.Nanosecond(); nanos != 0 {
+				ts = appendVarint(appendTag(ts, 2, wireVarint), uint64(nanos))
+			}
+			e = appendBytes(e[:0], 1, ts)
+			e = appendBytes(e, 2, []byte(en.line))
+			s = appendBytes(s, 2, e)
+		}
+		req = appendBytes(req, 1, s)
+	}
+	return req
+}
+
+// Protocol buffer wire types.
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return appendVarint(b, uint64(field<<3|wireType))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendBytes(b []byte, field int, data []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
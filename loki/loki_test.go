@@ -0,0 +1,326 @@
+package loki
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/handlertest"
+)
+
+// pushStream is a stream in a push request.
+type pushStream struct {
+	Labels  string
+	Entries []pushEntry
+}
+
+type pushEntry struct {
+	Timestamp time.Time
+	Line      string
+}
+
+// pushes returns the streams in each push request received by the server,
+// decoding the requests in either encoding.
+func pushes(t *testing.T, s *handlertest.Server) [][]pushStream {
+	var requests [][]pushStream
+	for _, r := range s.Requests() {
+		if r.Path != pushPath {
+			t.Fatal("unexpected path", r.Path)
+		}
+		var streams []pushStream
+		var err error
+		if r.Header.Get("Content-Type") == "application/json" {
+			streams, err = decodeJSON(r.Body)
+		} else {
+			var b []byte
+			if b, err = snappy.Decode(nil, r.Body); err == nil {
+				streams, err = decodeProtobuf(b)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, streams)
+	}
+	return requests
+}
+
+func decodeJSON(b []byte) ([]pushStream, error) {
+	var req struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+	var streams []pushStream
+	for _, s := range req.Streams {
+		ps := pushStream{Labels: formatLabels(s.Stream)}
+		for _, v := range s.Values {
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			ps.Entries = append(ps.Entries, pushEntry{time.Unix(0, ns).UTC(), v[1]})
+		}
+		streams = append(streams, ps)
+	}
+	return streams, nil
+}
+
+// protoFields decodes a protocol buffer message containing only
+// varint and length-delimited fields.
+func protoFields(b []byte) ([]int, []interface{}, error) {
+	var fields []int
+	var values []interface{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, nil, errors.New("bad tag")
+		}
+		b = b[n:]
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, nil, errors.New("bad varint")
+		}
+		b = b[n:]
+		fields = append(fields, int(tag>>3))
+		switch tag & 7 {
+		case wireVarint:
+			values = append(values, v)
+		case wireBytes:
+			if uint64(len(b)) < v {
+				return nil, nil, errors.New("short field")
+			}
+			values = append(values, b[:v])
+			b = b[v:]
+		default:
+			return nil, nil, errors.New("bad wire type")
+		}
+	}
+	return fields, values, nil
+}
+
+func decodeProtobuf(b []byte) ([]pushStream, error) {
+	var streams []pushStream
+	_, reqValues, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, sv := range reqValues {
+		var ps pushStream
+		fields, values, err := protoFields(sv.([]byte))
+		if err != nil {
+			return nil, err
+		}
+		for i, f := range fields {
+			if f == 1 {
+				ps.Labels = string(values[i].([]byte))
+				continue
+			}
+			var e pushEntry
+			efields, evalues, err := protoFields(values[i].([]byte))
+			if err != nil {
+				return nil, err
+			}
+			for j, ef := range efields {
+				if ef == 2 {
+					e.Line = string(evalues[j].([]byte))
+					continue
+				}
+				tfields, tvalues, err := protoFields(evalues[j].([]byte))
+				if err != nil {
+					return nil, err
+				}
+				var secs, nanos uint64
+				for k, tf := range tfields {
+					if tf == 1 {
+						secs = tvalues[k].(uint64)
+					} else {
+						nanos = tvalues[k].(uint64)
+					}
+				}
+				e.Timestamp = time.Unix(int64(secs), int64(nanos)).UTC()
+			}
+			ps.Entries = append(ps.Entries, e)
+		}
+		streams = append(streams, ps)
+	}
+	return streams, nil
+}
+
+func testMessage(level slog.Level, text string, props ...slog.Property) *slog.Message {
+	return &slog.Message{Timestamp: handlertest.Time, Level: level, Text: text, Properties: props}
+}
+
+func TestLabelsAndLine(t *testing.T) {
+	assert := assert.New(t)
+	h := &Handler{
+		config: Config{StaticLabels: map[string]string{"job": "app"}},
+		labels: map[string]string{"service": "service", "k8s.pod": "k8s_pod", "empty": "empty", "job": "job"},
+	}
+	m := &slog.Message{
+		Timestamp:  handlertest.Time,
+		Level:      slog.LevelWarning,
+		Text:       "disk almost full",
+		Err:        errors.New("quota exceeded"),
+		Logger:     "storage",
+		Properties: []slog.Property{{Key: "path", Value: "/data"}, {Key: "service", Value: "api"}, {Key: "empty", Value: ""}, {Key: "job", Value: "batch"}},
+		Context:    []slog.Property{{Key: "k8s.pod", Value: "api-1"}, {Key: "service", Value: "web"}},
+	}
+	m.SetCode("DISK")
+	label, line := h.labelsAndLine(m)
+	assert.Equal(map[string]string{"level": "warn", "job": "app", "service": "api", "k8s_pod": "api-1"}, label)
+	// properties whose label is empty or already set are kept in the line
+	assert.Equal(`msg="disk almost full" logger=storage error="quota exceeded" path=/data empty= job=batch service=web code=DISK`, line)
+	assert.Equal(`{job="app", k8s_pod="api-1", level="warn", service="api"}`, formatLabels(label))
+}
+
+func TestLabelName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("k8s_pod_name", LabelName("k8s.pod-name"))
+	assert.Equal("_1st", LabelName("1st"))
+	assert.Equal("", LabelName(""))
+}
+
+func TestStreamOrder(t *testing.T) {
+	assert := assert.New(t)
+	h := &Handler{labels: map[string]string{}, latest: map[string]time.Time{}}
+	t0 := handlertest.Time
+	msgs := []*slog.Message{
+		testMessage(slog.LevelInfo, "b"),
+		testMessage(slog.LevelError, "x"),
+		testMessage(slog.LevelInfo, "a"),
+	}
+	msgs[0].Timestamp = t0.Add(2 * time.Second)
+	msgs[2].Timestamp = t0.Add(time.Second)
+	streams := h.streams(msgs)
+	if assert.Len(streams, 2) {
+		assert.Equal(`{level="info"}`, streams[0].labels)
+		assert.Equal([]entry{{t0.Add(time.Second), `msg=a`}, {t0.Add(2 * time.Second), `msg=b`}}, streams[0].entries)
+		assert.Equal(`{level="error"}`, streams[1].labels)
+	}
+
+	// an entry earlier than the latest entry sent to its stream
+	// is sent with the latest timestamp
+	streams = h.streams([]*slog.Message{testMessage(slog.LevelInfo, "late")})
+	if assert.Len(streams, 1) {
+		assert.Equal(t0.Add(2*time.Second), streams[0].entries[0].timestamp)
+	}
+	streams = h.streams([]*slog.Message{testMessage(slog.LevelError, "same")})
+	if assert.Len(streams, 1) {
+		assert.Equal(t0, streams[0].entries[0].timestamp)
+	}
+
+	// streams without entries for longer than the TTL are forgotten
+	later := testMessage(slog.LevelWarning, "later")
+	later.Timestamp = t0.Add(2*time.Second + streamTTL)
+	h.streams([]*slog.Message{later})
+	assert.Equal(map[string]time.Time{
+		`{level="info"}`: t0.Add(2 * time.Second),
+		`{level="warn"}`: later.Timestamp,
+	}, h.latest)
+	later.Timestamp = later.Timestamp.Add(time.Millisecond)
+	h.streams([]*slog.Message{later})
+	assert.Equal(map[string]time.Time{`{level="warn"}`: later.Timestamp}, h.latest)
+}
+
+func TestPush(t *testing.T) {
+	for _, encoding := range []string{EncodingJSON, EncodingProtobuf} {
+		t.Run(encoding, func(t *testing.T) {
+			assert := assert.New(t)
+			s := handlertest.NewServer(t)
+			h, err := New(Config{
+				URL:           s.URL,
+				Encoding:      encoding,
+				Labels:        []string{"service"},
+				TenantID:      "tenant1",
+				FlushInterval: time.Hour,
+			})
+			if !assert.NoError(err) {
+				return
+			}
+			defer h.Close()
+			h.Handle([]*slog.Message{
+				testMessage(slog.LevelInfo, "one", slog.Property{Key: "service", Value: "api"}, slog.Property{Key: "n", Value: 1}),
+				testMessage(slog.LevelInfo, "two", slog.Property{Key: "service", Value: "web"}),
+				testMessage(slog.LevelInfo, "three", slog.Property{Key: "service", Value: "api"}),
+			})
+			assert.NoError(h.Flush())
+
+			if requests := pushes(t, s); assert.Len(requests, 1) {
+				assert.Equal([]pushStream{
+					{`{level="info", service="api"}`, []pushEntry{{handlertest.Time, "msg=one n=1"}, {handlertest.Time, "msg=three"}}},
+					{`{level="info", service="web"}`, []pushEntry{{handlertest.Time, "msg=two"}}},
+				}, requests[0])
+				assert.Equal("tenant1", s.Requests()[0].Header.Get("X-Scope-OrgID"))
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewServer(t, http.StatusServiceUnavailable, http.StatusBadRequest)
+	var errs []error
+	h, err := New(Config{
+		URL:           s.URL,
+		Encoding:      EncodingJSON,
+		FlushInterval: time.Hour,
+		MinBackoff:    time.Millisecond,
+		OnError:       func(err error) { errs = append(errs, err) },
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+
+	// a server error is retried, and a client error is not
+	h.Handle([]*slog.Message{testMessage(slog.LevelInfo, "one")})
+	err = h.Flush()
+	if assert.IsType(&StatusError{}, err) {
+		assert.Equal("loki: 400 Bad Request: Bad Request", err.Error())
+		assert.False(err.(*StatusError).Temporary())
+	}
+	assert.Len(s.Requests(), 2)
+
+	h.Handle([]*slog.Message{testMessage(slog.LevelInfo, "two")})
+	assert.NoError(h.Flush())
+	assert.NoError(h.Close())
+	assert.Len(errs, 1)
+}
+
+func TestConfigFactory(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewServer(t)
+	l := handlertest.ConfigLogger(t, "loki", `{"url": "`+s.URL+`", "labels": ["region"], "static_labels": {"job": "cfg"}, "flush_interval": "1h"}`)
+	ctx := slog.NewContext(context.Background(), slog.Property{Key: "region", Value: "eu"})
+	l.Info(ctx, "configured")
+	assert.NoError(l.Flush())
+
+	if requests := pushes(t, s); assert.Len(requests, 1) && assert.Len(requests[0], 1) {
+		assert.Equal(`{job="cfg", level="info", region="eu"}`, requests[0][0].Labels)
+		assert.Equal("msg=configured", requests[0][0].Entries[0].Line)
+	}
+
+	_, err := New(Config{})
+	assert.Equal(errNoURL, err)
+	_, err = New(Config{URL: s.URL, Encoding: "xml"})
+	assert.Equal(errUnknownEncoding, err)
+	_, err = New(Config{URL: s.URL, StaticLabels: map[string]string{"level": "info"}})
+	assert.Equal(errLevelLabel, err)
+	_, err = New(Config{URL: s.URL, StaticLabels: map[string]string{"k8s.pod": "api-1"}})
+	assert.EqualError(err, `loki: invalid static label name "k8s.pod"`)
+}
@@ -17,6 +17,7 @@ type Message struct {
 	Err        error
 	Properties []Property
 	Context    []Property
+	Logger     string // name of the named logger, if any
 	code       string
 	status     int
 }
@@ -27,9 +28,9 @@ type Property struct {
 	Value interface{}
 }
 
-func newMessage(ctx context.Context, level Level, text string) *Message {
+func newMessage(ctx context.Context, timestamp time.Time, level Level, text string) *Message {
 	m := &Message{
-		Timestamp: time.Now(),
+		Timestamp: timestamp,
 		Level:     level,
 		Text:      text,
 	}
@@ -53,6 +54,15 @@ func (m *Message) applyOpts(opts []Option) *Message {
 	return m
 }
 
+// Clone returns a copy of the message. The properties and context of
+// the copy can be modified without affecting the original message.
+func (m *Message) Clone() *Message {
+	c := *m
+	c.Properties = append([]Property(nil), m.Properties...)
+	c.Context = append([]Property(nil), m.Context...)
+	return &c
+}
+
 // Error implements the error interface
 func (m *Message) Error() string {
 	return m.Text
@@ -92,11 +102,17 @@ func (m *Message) Logfmt() string {
 }
 
 func (m *Message) logfmtBuffer() logfmt.Buffer {
-	var buf logfmt.Buffer
+	return LogfmtFormatter{}.buffer(m)
+}
 
-	buf.WriteTimestamp(m.Timestamp)
+// writeLogfmt writes the contents of the message following
+// the timestamp to the buffer in logfmt format.
+func (m *Message) writeLogfmt(buf *logfmt.Buffer) {
 	buf.WriteKey(m.Level.String())
 	buf.WriteProperty("msg", m.Text)
+	if m.Logger != "" {
+		buf.WriteProperty("logger", m.Logger)
+	}
 	if m.Err != nil {
 		buf.WriteProperty("error", m.Err.Error())
 	}
@@ -116,6 +132,4 @@ func (m *Message) logfmtBuffer() logfmt.Buffer {
 	if m.status != 0 {
 		buf.WriteProperty("status", m.status)
 	}
-
-	return buf
 }
@@ -0,0 +1,74 @@
+package slog
+
+import (
+	"sort"
+	"sync"
+)
+
+// named is the registry of named loggers.
+var named = struct {
+	sync.Mutex
+	loggers map[string]*loggerImpl
+}{
+	loggers: make(map[string]*loggerImpl),
+}
+
+// Named returns the logger with the given name, creating it if it does
+// not already exist. Named loggers make it possible to control the
+// minimum level of different parts of an application independently.
+//
+// Messages logged to a named logger include the logger name, and are
+// output by the default logger in addition to any output and handlers
+// set on the named logger itself. By default a named logger has no
+// output of its own, and inherits its minimum level from the default
+// logger until its minimum level is set.
+func Named(name string) Logger {
+	if name == "" {
+		return Default
+	}
+	named.Lock()
+	defer named.Unlock()
+	l, ok := named.loggers[name]
+	if !ok {
+		l = &loggerImpl{
+			name:     name,
+			exitCode: 1,
+			calls:    new(sync.WaitGroup),
+		}
+		named.loggers[name] = l
+	}
+	return l
+}
+
+// lookupNamed returns the named logger with the given name,
+// or nil if no logger has been created with that name.
+func lookupNamed(name string) *loggerImpl {
+	named.Lock()
+	defer named.Unlock()
+	return named.loggers[name]
+}
+
+// namedLoggers returns the names of all named loggers in sorted order.
+func namedLoggers() []string {
+	named.Lock()
+	defer named.Unlock()
+	names := make([]string, 0, len(named.loggers))
+	for name := range named.loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parent returns the logger that a named logger passes its messages
+// on to, which is the default logger. Returns nil for other loggers.
+func (l *loggerImpl) parent() *loggerImpl {
+	if l.name == "" {
+		return nil
+	}
+	p, ok := Default.(*loggerImpl)
+	if !ok || p == l {
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,58 @@
+package slog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+)
+
+func TestNamed(t *testing.T) {
+	assert := assert.New(t)
+	Default = New()
+	defer func() { Default = New() }()
+	SetOutput(ioutil.Discard)
+	th := &testHandler{}
+	AddHandler(th)
+	ctx := context.Background()
+
+	assert.Exactly(Default, Named(""))
+	db := Named("test-named-db")
+	assert.Exactly(db, Named("test-named-db"))
+	assert.Contains(namedLoggers(), "test-named-db")
+
+	// inherits level from the default logger
+	db.Debug(ctx, "debug message")
+	assert.Equal(0, len(th.Messages))
+	SetMinLevel(LevelDebug)
+	db.Debug(ctx, "debug message")
+	assert.Equal(1, len(th.Messages))
+	assert.Equal("test-named-db", th.Messages[0].Logger)
+	assert.Contains(th.Messages[0].Logfmt(), `msg="debug message" logger=test-named-db`)
+
+	// own level once set, does not affect the default logger
+	th.Messages = nil
+	db.SetMinLevel(LevelWarning)
+	db.Info(ctx, "info message")
+	Info(ctx, "info message")
+	assert.Equal(1, len(th.Messages))
+	assert.Equal(LevelDebug, Default.LevelVar().Level())
+
+	// back to inheriting
+	db.SetLevelVar(nil)
+	assert.Equal(LevelDebug, db.LevelVar().Level())
+
+	// output and handlers of the named logger
+	var buf bytes.Buffer
+	db.SetOutput(&buf)
+	dbHandler := &testHandler{}
+	db.AddHandler(dbHandler)
+	th.Messages = nil
+	db.Info(ctx, "info message")
+	assert.Equal(1, len(th.Messages))
+	assert.Equal(1, len(dbHandler.Messages))
+	assert.Contains(buf.String(), "logger=test-named-db")
+}
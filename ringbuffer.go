@@ -0,0 +1,206 @@
+package slog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RingBuffer is a Handler that keeps the most recent messages in memory,
+// so that they can be included in crash reports or served by a debug
+// endpoint. Once the buffer is full, the oldest messages are discarded.
+// A RingBuffer is safe for concurrent use.
+type RingBuffer struct {
+	maxMessages int
+	maxBytes    int
+
+	mu      sync.RWMutex // protects the following fields
+	entries []ringEntry  // circular buffer of entries
+	head    int          // index of the oldest entry
+	count   int          // number of entries in the buffer
+	bytes   int          // total size of entries in the buffer
+}
+
+type ringEntry struct {
+	msg  *Message
+	size int
+}
+
+// NewRingBuffer returns a ring buffer that keeps at most maxMessages messages
+// and at most maxBytes bytes of messages, where the size of a message is the
+// length of its logfmt representation. A zero value for either limit means
+// no limit, but at least one limit must be specified.
+func NewRingBuffer(maxMessages, maxBytes int) *RingBuffer {
+	if maxMessages <= 0 && maxBytes <= 0 {
+		panic("slog: NewRingBuffer requires a limit")
+	}
+	rb := &RingBuffer{
+		maxMessages: maxMessages,
+		maxBytes:    maxBytes,
+	}
+	if maxMessages > 0 {
+		rb.entries = make([]ringEntry, maxMessages)
+	}
+	return rb
+}
+
+// Handle implements the Handler interface.
+func (rb *RingBuffer) Handle(msgs []*Message) {
+	// calculate sizes before acquiring the lock
+	sizes := make([]int, len(msgs))
+	if rb.maxBytes > 0 {
+		for i, m := range msgs {
+			buf := m.logfmtBuffer()
+			sizes[i] = buf.Len()
+			buf.Reset()
+		}
+	}
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	for i, m := range msgs {
+		rb.add(ringEntry{msg: m, size: sizes[i]})
+	}
+}
+
+// add appends an entry, discarding the oldest entries if necessary.
+func (rb *RingBuffer) add(e ringEntry) {
+	if rb.maxBytes > 0 && e.size > rb.maxBytes {
+		// will never fit
+		return
+	}
+	for rb.count > 0 && (rb.count == rb.maxMessages || (rb.maxBytes > 0 && rb.bytes+e.size > rb.maxBytes)) {
+		rb.removeOldest()
+	}
+	if rb.count == len(rb.entries) {
+		// only happens without a message limit: grow the buffer
+		entries := make([]ringEntry, len(rb.entries)*2+16)
+		for i := 0; i < rb.count; i++ {
+			entries[i] = rb.entries[(rb.head+i)%len(rb.entries)]
+		}
+		rb.entries = entries
+		rb.head = 0
+	}
+	rb.entries[(rb.head+rb.count)%len(rb.entries)] = e
+	rb.count++
+	rb.bytes += e.size
+}
+
+func (rb *RingBuffer) removeOldest() {
+	rb.bytes -= rb.entries[rb.head].size
+	rb.entries[rb.head] = ringEntry{}
+	rb.head = (rb.head + 1) % len(rb.entries)
+	rb.count--
+}
+
+// Len returns the number of messages in the buffer.
+func (rb *RingBuffer) Len() int {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return rb.count
+}
+
+// Clear discards all messages in the buffer.
+func (rb *RingBuffer) Clear() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	for rb.count > 0 {
+		rb.removeOldest()
+	}
+}
+
+// Messages returns all messages in the buffer, oldest first.
+func (rb *RingBuffer) Messages() []*Message {
+	return rb.Query(Query{})
+}
+
+// Query returns the messages in the buffer that match the query, oldest first.
+func (rb *RingBuffer) Query(q Query) []*Message {
+	rb.mu.RLock()
+	msgs := make([]*Message, 0, rb.count)
+	for i := 0; i < rb.count; i++ {
+		msgs = append(msgs, rb.entries[(rb.head+i)%len(rb.entries)].msg)
+	}
+	rb.mu.RUnlock()
+
+	// match outside the lock: messages are not modified once logged
+	var matched []*Message
+	for _, m := range msgs {
+		if q.Match(m) {
+			matched = append(matched, m)
+		}
+	}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[len(matched)-q.Limit:]
+	}
+	return matched
+}
+
+// ByLevel returns the messages in the buffer with a level of at least minLevel.
+func (rb *RingBuffer) ByLevel(minLevel Level) []*Message {
+	return rb.Query(Query{MinLevel: minLevel})
+}
+
+// Between returns the messages in the buffer with timestamps
+// at or after since, and before until.
+func (rb *RingBuffer) Between(since, until time.Time) []*Message {
+	return rb.Query(Query{Since: since, Until: until})
+}
+
+// WithProperty returns the messages in the buffer that have a property
+// or context value with the given key and value. See Query.
+func (rb *RingBuffer) WithProperty(key, value string) []*Message {
+	return rb.Query(Query{Key: key, Value: value})
+}
+
+// WithCode returns the messages in the buffer with the given code.
+func (rb *RingBuffer) WithCode(code string) []*Message {
+	return rb.Query(Query{Code: code})
+}
+
+// Query describes the messages to select from a RingBuffer. Zero-valued
+// fields are ignored, so the zero value Query matches all messages.
+type Query struct {
+	MinLevel Level     // Minimum level
+	MaxLevel Level     // Maximum level
+	Since    time.Time // Timestamp at or after
+	Until    time.Time // Timestamp before
+	Key      string    // Property or context key
+	Value    string    // Value for Key, compared with the value formatted by fmt.Sprint
+	Code     string    // Message code
+	Text     string    // Message text
+	Limit    int       // Maximum number of messages, the most recent are returned
+}
+
+// Match reports whether the message matches the query. The Limit
+// field is not considered.
+func (q *Query) Match(m *Message) bool {
+	if !inLevelRange(m.Level, q.MinLevel, q.MaxLevel) {
+		return false
+	}
+	if !q.Since.IsZero() && m.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !m.Timestamp.Before(q.Until) {
+		return false
+	}
+	if q.Code != "" && m.code != q.Code {
+		return false
+	}
+	if q.Text != "" && m.Text != q.Text {
+		return false
+	}
+	if q.Key != "" && !q.matchProperty(m.Properties) && !q.matchProperty(m.Context) {
+		return false
+	}
+	return true
+}
+
+func (q *Query) matchProperty(props []Property) bool {
+	for _, p := range props {
+		if p.Key == q.Key && (q.Value == "" || fmt.Sprint(p.Value) == q.Value) {
+			return true
+		}
+	}
+	return false
+}
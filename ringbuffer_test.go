@@ -0,0 +1,88 @@
+package slog
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+)
+
+func TestRingBufferMaxMessages(t *testing.T) {
+	assert := assert.New(t)
+	rb := NewRingBuffer(3, 0)
+	for i := 0; i < 5; i++ {
+		rb.Handle([]*Message{{Text: fmt.Sprint(i)}})
+	}
+	assert.Equal(3, rb.Len())
+	var texts []string
+	for _, m := range rb.Messages() {
+		texts = append(texts, m.Text)
+	}
+	assert.Equal([]string{"2", "3", "4"}, texts)
+
+	rb.Clear()
+	assert.Equal(0, rb.Len())
+	assert.Empty(rb.Messages())
+}
+
+func TestRingBufferMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	m := &Message{Timestamp: time.Now(), Level: LevelInfo, Text: "message"}
+	size := len(m.Logfmt())
+	rb := NewRingBuffer(0, size*10+size/2)
+	for i := 0; i < 100; i++ {
+		rb.Handle([]*Message{m})
+	}
+	assert.Equal(10, rb.Len())
+
+	// message larger than the buffer is discarded
+	rb = NewRingBuffer(0, size-1)
+	rb.Handle([]*Message{m})
+	assert.Equal(0, rb.Len())
+
+	assert.Panics(func() { NewRingBuffer(0, 0) })
+}
+
+func TestRingBufferQuery(t *testing.T) {
+	assert := assert.New(t)
+	t0 := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	rb := NewRingBuffer(100, 0)
+	rb.Handle([]*Message{
+		{Timestamp: t0, Level: LevelDebug, Text: "m0", Properties: []Property{{"user", "alice"}}},
+		{Timestamp: t0.Add(time.Second), Level: LevelInfo, Text: "m1", Context: []Property{{"user", "bob"}}},
+		{Timestamp: t0.Add(2 * time.Second), Level: LevelWarning, Text: "m2", code: "C1"},
+		{Timestamp: t0.Add(3 * time.Second), Level: LevelError, Text: "m3", Properties: []Property{{"n", 42}}},
+	})
+
+	texts := func(msgs []*Message) []string {
+		var texts []string
+		for _, m := range msgs {
+			texts = append(texts, m.Text)
+		}
+		return texts
+	}
+
+	assert.Equal([]string{"m2", "m3"}, texts(rb.ByLevel(LevelWarning)))
+	assert.Equal([]string{"m1", "m2"}, texts(rb.Between(t0.Add(time.Second), t0.Add(3*time.Second))))
+	assert.Equal([]string{"m1"}, texts(rb.WithProperty("user", "bob")))
+	assert.Equal([]string{"m0", "m1"}, texts(rb.WithProperty("user", "")))
+	assert.Equal([]string{"m3"}, texts(rb.WithProperty("n", "42")))
+	assert.Equal([]string{"m2"}, texts(rb.WithCode("C1")))
+	assert.Equal([]string{"m2", "m3"}, texts(rb.Query(Query{Limit: 2})))
+	assert.Equal([]string{"m1"}, texts(rb.Query(Query{MinLevel: LevelInfo, MaxLevel: LevelInfo})))
+	assert.Equal([]string{"m0"}, texts(rb.Query(Query{Text: "m0"})))
+	assert.Empty(rb.Query(Query{Key: "missing"}))
+}
+
+func TestRingBufferHandler(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(nil)
+	rb := NewRingBuffer(10, 0)
+	l.AddHandler(rb)
+	l.Info(context.Background(), "info message")
+	assert.Equal(1, rb.Len())
+}
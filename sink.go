@@ -0,0 +1,56 @@
+package slog
+
+import "io"
+
+// A Sink is an additional destination for the messages output by a Logger.
+// Each sink has its own writer, format and range of levels. For example, a
+// logger might write debug messages and above to a local file in logfmt
+// format, and warning messages and above to stderr in JSON format.
+//
+// The level range of a sink further restricts the messages that have
+// passed the logger's minimum level: a sink with a minimum level of
+// LevelDebug only receives debug messages if the logger's minimum level
+// is LevelDebug or lower. A zero MinLevel or MaxLevel means no minimum
+// or maximum respectively.
+type Sink struct {
+	Writer    io.Writer // Destination for output
+	Formatter Formatter // Format of output, logfmt if nil
+	MinLevel  Level     // Minimum level written to the sink
+	MaxLevel  Level     // Maximum level written to the sink
+}
+
+// write writes the message to the sink if the message level is
+// within the sink's level range.
+func (s *Sink) write(m *Message) {
+	if s.Writer == nil || !inLevelRange(m.Level, s.MinLevel, s.MaxLevel) {
+		return
+	}
+	formatMessage(s.Writer, s.Formatter, m)
+}
+
+// inLevelRange reports whether level is between min and max inclusive.
+// A zero min or max means no minimum or maximum respectively.
+func inLevelRange(level, min, max Level) bool {
+	return level >= min && (max == 0 || level <= max)
+}
+
+// formatMessage writes the message to w using formatter f,
+// or logfmt format if f is nil.
+func formatMessage(w io.Writer, f Formatter, m *Message) error {
+	if f == nil {
+		f = LogfmtFormatter{}
+	}
+	return f.Format(w, m)
+}
+
+// flushWriter flushes w if it implements Flusher or is a file.
+func flushWriter(w io.Writer) error {
+	switch w := w.(type) {
+	case Flusher:
+		return w.Flush()
+	case syncer:
+		// Sync fails for terminals and pipes, which do not need flushing
+		w.Sync()
+	}
+	return nil
+}
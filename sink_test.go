@@ -0,0 +1,72 @@
+package slog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+)
+
+func TestSinks(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(nil)
+	l.SetMinLevel(LevelDebug)
+	var all, warn, info bytes.Buffer
+	l.SetSinks(
+		Sink{Writer: &all},
+		Sink{Writer: &warn, Formatter: JSONFormatter{}, MinLevel: LevelWarning},
+	)
+	l.AddSink(Sink{Writer: &info, MinLevel: LevelInfo, MaxLevel: LevelInfo})
+	ctx := context.Background()
+
+	l.Trace(ctx, "trace message")
+	l.Debug(ctx, "debug message")
+	l.Info(ctx, "info message")
+	l.Warn(ctx, "warn message")
+	l.Error(ctx, "error message")
+
+	assert.Equal(4, bytes.Count(all.Bytes(), []byte("\n")))
+	assert.NotContains(all.String(), "trace message")
+	assert.Equal(2, bytes.Count(warn.Bytes(), []byte("\n")))
+	assert.Contains(warn.String(), `"level":"warn","msg":"warn message"`)
+	assert.Contains(warn.String(), `"level":"error","msg":"error message"`)
+	assert.Equal(1, bytes.Count(info.Bytes(), []byte("\n")))
+	assert.Contains(info.String(), `info msg="info message"`)
+}
+
+func TestAddLevelHandler(t *testing.T) {
+	assert := assert.New(t)
+	l := New()
+	l.SetOutput(nil)
+	l.SetMinLevel(LevelTrace)
+	all := &testHandler{}
+	warn := &testHandler{}
+	debug := &testHandler{}
+	l.AddHandler(all)
+	l.AddLevelHandler(warn, LevelWarning, 0)
+	l.AddLevelHandler(debug, 0, LevelDebug)
+	ctx := context.Background()
+
+	l.Trace(ctx, "trace message")
+	l.Debug(ctx, "debug message")
+	l.Info(ctx, "info message")
+	l.Warn(ctx, "warn message")
+	l.Error(ctx, "error message")
+
+	assert.Equal(5, len(all.Messages))
+	assert.Equal(2, len(warn.Messages))
+	assert.Equal(LevelWarning, warn.Messages[0].Level)
+	assert.Equal(2, len(debug.Messages))
+	assert.Equal(LevelTrace, debug.Messages[0].Level)
+}
+
+func TestInLevelRange(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(inLevelRange(LevelTrace, 0, 0))
+	assert.True(inLevelRange(LevelInfo, LevelInfo, LevelInfo))
+	assert.False(inLevelRange(LevelDebug, LevelInfo, 0))
+	assert.False(inLevelRange(LevelWarning, 0, LevelInfo))
+}
@@ -0,0 +1,55 @@
+package slogtest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake slog.Clock for tests. Its time only changes when it is
+// set or advanced, or by a fixed step each time Now is called, so message
+// timestamps are predictable. A Clock is safe for concurrent use.
+//
+//	clock := slogtest.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+//	logger.SetClock(clock)
+type Clock struct {
+	mu   sync.Mutex // protects the following fields
+	now  time.Time
+	step time.Duration
+}
+
+// NewClock returns a fake clock set to t.
+func NewClock(t time.Time) *Clock {
+	return &Clock{now: t}
+}
+
+// Now returns the clock's current time, and then advances the
+// clock by its step, if any.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// Set sets the clock's current time.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Advance moves the clock's current time forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SetStep sets the amount that the clock advances each time Now
+// is called. A zero step, which is the default, stops the clock.
+func (c *Clock) SetStep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.step = d
+}
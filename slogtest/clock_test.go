@@ -0,0 +1,44 @@
+package slogtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+
+	"github.com/spkg/slog"
+)
+
+func TestClock(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewClock(start)
+	assert.Equal(start, clock.Now())
+	assert.Equal(start, clock.Now())
+
+	clock.Advance(time.Second)
+	assert.Equal(start.Add(time.Second), clock.Now())
+
+	clock.Set(start)
+	clock.SetStep(time.Millisecond)
+	assert.Equal(start, clock.Now())
+	assert.Equal(start.Add(time.Millisecond), clock.Now())
+}
+
+func TestClockLogger(t *testing.T) {
+	assert := assert.New(t)
+	l, rec := NewLogger(t)
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewClock(start)
+	l.SetClock(clock)
+
+	l.Info(context.Background(), "first")
+	clock.Advance(1500 * time.Millisecond)
+	m := l.Info(context.Background(), "second", slog.WithElapsed(start))
+
+	assert.Equal(start, rec.Messages()[0].Timestamp)
+	assert.Equal(start.Add(1500*time.Millisecond), m.Timestamp)
+	assert.True(rec.Contains(Text("second"), Property("elapsed", "1.5s")))
+}
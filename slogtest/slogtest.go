@@ -0,0 +1,280 @@
+// Package slogtest provides support for testing code that logs
+// messages using the slog package.
+//
+// A Recorder captures the messages sent to a logger for the duration
+// of a test, and provides assertions about the captured messages.
+//
+//	func TestSomething(t *testing.T) {
+//		rec := slogtest.Capture(t, slog.Default)
+//		DoSomething()
+//		rec.HasMessage(slog.LevelInfo, "something done")
+//		rec.Contains(slogtest.Level(slog.LevelWarning), slogtest.Property("user", "alice"))
+//	}
+//
+// If the test fails, the captured messages are written to the test log.
+package slogtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spkg/slog"
+)
+
+// Recorder is a slog.Handler that captures messages, and reports
+// failed assertions about the captured messages to a test.
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	t testing.TB
+
+	mu   sync.Mutex // protects msgs
+	msgs []*slog.Message
+}
+
+// NewRecorder returns a recorder that reports failed assertions to t.
+// The recorder does not receive any messages until it is added to a
+// logger as a handler. Use Capture to add the recorder to a logger for
+// the duration of the test.
+func NewRecorder(t testing.TB) *Recorder {
+	r := &Recorder{t: t}
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("captured log messages:\n%s", r.Dump())
+		}
+	})
+	return r
+}
+
+// Capture returns a recorder that captures all messages sent to the
+// logger's handlers until the test has finished.
+func Capture(t testing.TB, l slog.Logger) *Recorder {
+	r := NewRecorder(t)
+	reg := l.AddHandler(r)
+	t.Cleanup(reg.Remove)
+	return r
+}
+
+// NewLogger returns a new logger, and a recorder that captures all of
+// its messages. The logger's minimum level is LevelTrace, and its output
+// is discarded, so only the recorder receives messages.
+func NewLogger(t testing.TB) (slog.Logger, *Recorder) {
+	l := slog.New()
+	l.SetOutput(ioutil.Discard)
+	l.SetMinLevel(slog.LevelTrace)
+	return l, Capture(t, l)
+}
+
+// Handle implements the slog.Handler interface.
+func (r *Recorder) Handle(msgs []*slog.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msgs...)
+}
+
+// Messages returns the captured messages in the order they were logged.
+func (r *Recorder) Messages() []*slog.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*slog.Message(nil), r.msgs...)
+}
+
+// Len returns the number of captured messages.
+func (r *Recorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.msgs)
+}
+
+// Reset discards all captured messages.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = nil
+}
+
+// Filter returns the captured messages that match all of the matchers.
+func (r *Recorder) Filter(matchers ...Matcher) []*slog.Message {
+	var msgs []*slog.Message
+	for _, m := range r.Messages() {
+		if matchAll(m, matchers) {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// HasMessage asserts that a message with the level and text has been captured.
+func (r *Recorder) HasMessage(level slog.Level, text string) bool {
+	r.t.Helper()
+	return r.Contains(Level(level), Text(text))
+}
+
+// Contains asserts that a captured message matches all of the matchers.
+func (r *Recorder) Contains(matchers ...Matcher) bool {
+	r.t.Helper()
+	if len(r.Filter(matchers...)) == 0 {
+		r.t.Errorf("no message matches %s", describe(matchers))
+		return false
+	}
+	return true
+}
+
+// NotContains asserts that no captured message matches all of the matchers.
+func (r *Recorder) NotContains(matchers ...Matcher) bool {
+	r.t.Helper()
+	if msgs := r.Filter(matchers...); len(msgs) > 0 {
+		r.t.Errorf("unexpected message matches %s:\n%s", describe(matchers), dump(msgs))
+		return false
+	}
+	return true
+}
+
+// InOrder asserts that messages matching each of the matchers have been
+// captured in the order given. Other messages may be captured before, after
+// and in between the matching messages.
+func (r *Recorder) InOrder(matchers ...Matcher) bool {
+	r.t.Helper()
+	msgs := r.Messages()
+	i := 0
+	for _, matcher := range matchers {
+		for i < len(msgs) && !matcher.Match(msgs[i]) {
+			i++
+		}
+		if i == len(msgs) {
+			r.t.Errorf("no message matches %s in order", matcher)
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// Dump returns the captured messages in logfmt format, one per line.
+func (r *Recorder) Dump() string {
+	return dump(r.Messages())
+}
+
+func dump(msgs []*slog.Message) string {
+	var buf bytes.Buffer
+	for _, m := range msgs {
+		buf.WriteString(m.Logfmt())
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// Matcher is a condition that a message can satisfy.
+type Matcher struct {
+	desc  string
+	match func(m *slog.Message) bool
+}
+
+// Match reports whether the message satisfies the condition.
+func (mr Matcher) Match(m *slog.Message) bool {
+	return mr.match(m)
+}
+
+// String returns a description of the condition.
+func (mr Matcher) String() string {
+	return mr.desc
+}
+
+// Func returns a matcher that matches messages for which fn returns true.
+// The description is used when reporting failed assertions.
+func Func(desc string, fn func(m *slog.Message) bool) Matcher {
+	return Matcher{desc: desc, match: fn}
+}
+
+// Level matches messages with the level.
+func Level(level slog.Level) Matcher {
+	return Func("level="+level.String(), func(m *slog.Message) bool {
+		return m.Level == level
+	})
+}
+
+// MinLevel matches messages with a level of at least level.
+func MinLevel(level slog.Level) Matcher {
+	return Func("level>="+level.String(), func(m *slog.Message) bool {
+		return m.Level >= level
+	})
+}
+
+// Text matches messages with the text.
+func Text(text string) Matcher {
+	return Func(fmt.Sprintf("msg=%q", text), func(m *slog.Message) bool {
+		return m.Text == text
+	})
+}
+
+// TextContains matches messages with text containing substr.
+func TextContains(substr string) Matcher {
+	return Func(fmt.Sprintf("msg~%q", substr), func(m *slog.Message) bool {
+		return strings.Contains(m.Text, substr)
+	})
+}
+
+// Code matches messages with the code.
+func Code(code string) Matcher {
+	return Func("code="+code, func(m *slog.Message) bool {
+		return m.Code() == code
+	})
+}
+
+// Logger matches messages logged to the named logger.
+// An empty name matches messages logged to unnamed loggers.
+func Logger(name string) Matcher {
+	return Func("logger="+name, func(m *slog.Message) bool {
+		return m.Logger == name
+	})
+}
+
+// Property matches messages with a property or context value with the key
+// and value. Values are compared after formatting them with fmt.Sprint, so
+// Property("id", 1) and Property("id", "1") are equivalent.
+func Property(key string, value interface{}) Matcher {
+	want := fmt.Sprint(value)
+	return Func(fmt.Sprintf("%s=%v", key, value), func(m *slog.Message) bool {
+		return findProperty(m, key, func(v interface{}) bool {
+			return fmt.Sprint(v) == want
+		})
+	})
+}
+
+// HasProperty matches messages with a property or context value with the key.
+func HasProperty(key string) Matcher {
+	return Func(key+"=*", func(m *slog.Message) bool {
+		return findProperty(m, key, func(interface{}) bool { return true })
+	})
+}
+
+func findProperty(m *slog.Message, key string, match func(v interface{}) bool) bool {
+	for _, props := range [][]slog.Property{m.Properties, m.Context} {
+		for _, p := range props {
+			if p.Key == key && match(p.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchAll(m *slog.Message, matchers []Matcher) bool {
+	for _, matcher := range matchers {
+		if !matcher.Match(m) {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(matchers []Matcher) string {
+	descs := make([]string, len(matchers))
+	for i, matcher := range matchers {
+		descs[i] = matcher.String()
+	}
+	return "{" + strings.Join(descs, " ") + "}"
+}
@@ -0,0 +1,110 @@
+package slogtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+
+	"github.com/spkg/slog"
+)
+
+// fakeT records errors instead of failing the test.
+type fakeT struct {
+	testing.TB
+	errors   []string
+	logs     []string
+	cleanups []func()
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Logf(format string, args ...interface{}) {
+	t.logs = append(t.logs, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Failed() bool {
+	return len(t.errors) > 0
+}
+
+func (t *fakeT) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+func (t *fakeT) finish() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	assert := assert.New(t)
+	l, rec := NewLogger(t)
+	ctx := slog.NewContext(context.Background(), slog.Property{Key: "request", Value: 42})
+
+	l.Debug(ctx, "starting")
+	l.Info(ctx, "user logged in", slog.WithValue("user", "alice"))
+	l.Warn(ctx, "slow response", slog.WithCode("SLOW"))
+	l.Error(ctx, "request failed")
+
+	assert.Equal(4, rec.Len())
+	assert.True(rec.HasMessage(slog.LevelInfo, "user logged in"))
+	assert.True(rec.Contains(Property("user", "alice"), Property("request", "42")))
+	assert.True(rec.Contains(Code("SLOW"), MinLevel(slog.LevelWarning)))
+	assert.True(rec.Contains(HasProperty("request"), TextContains("failed")))
+	assert.True(rec.NotContains(Level(slog.LevelTrace)))
+	assert.True(rec.InOrder(Text("starting"), Level(slog.LevelWarning), Text("request failed")))
+	assert.Len(rec.Filter(MinLevel(slog.LevelWarning)), 2)
+	assert.Len(rec.Filter(Logger("")), 4)
+
+	rec.Reset()
+	assert.Equal(0, rec.Len())
+	assert.Empty(rec.Dump())
+}
+
+func TestRecorderFailures(t *testing.T) {
+	assert := assert.New(t)
+	ft := &fakeT{}
+	l, rec := NewLogger(ft)
+	l.Info(context.Background(), "first")
+	l.Info(context.Background(), "second")
+
+	assert.False(rec.HasMessage(slog.LevelError, "first"))
+	assert.False(rec.NotContains(Text("second")))
+	assert.False(rec.InOrder(Text("second"), Text("first")))
+	if assert.Len(ft.errors, 3) {
+		assert.Equal(`no message matches {level=error msg="first"}`, ft.errors[0])
+		assert.Contains(ft.errors[1], "msg=second")
+		assert.Equal(`no message matches msg="first" in order`, ft.errors[2])
+	}
+
+	ft.finish()
+	if assert.Len(ft.logs, 1) {
+		assert.Contains(ft.logs[0], "msg=first")
+		assert.Contains(ft.logs[0], "msg=second")
+	}
+
+	// recorder is removed from the logger after the test
+	l.Info(context.Background(), "third")
+	assert.Equal(2, rec.Len())
+}
+
+func TestCapture(t *testing.T) {
+	assert := assert.New(t)
+	l := slog.New()
+	ft := &fakeT{}
+	rec := Capture(ft, l)
+	l.SetOutput(nil)
+	l.Debug(context.Background(), "ignored")
+	l.Info(context.Background(), "captured")
+	assert.Equal(1, rec.Len())
+
+	ft.finish()
+	assert.Empty(ft.logs)
+}
@@ -0,0 +1,457 @@
+// Package spool provides a durable first-in first-out queue of records
+// stored in a directory, for handlers that must keep messages that cannot
+// be delivered yet, including across process restarts.
+//
+//	s, err := spool.Open("/var/spool/myapp", spool.Options{MaxSize: 64 << 20})
+//	if err != nil {
+//		return err
+//	}
+//	defer s.Close()
+//	s.Append(record)
+//
+//	// later, when delivery is possible
+//	for {
+//		record, err := s.Peek()
+//		if err != nil {
+//			break // io.EOF when the spool is empty
+//		}
+//		if deliver(record) != nil {
+//			break // try again later
+//		}
+//		s.Commit()
+//	}
+//
+// Records are appended to segment files, each record preceded by its length
+// and CRC-32 checksum. A segment is removed once all its records have been
+// committed, and the position of the oldest uncommitted record is kept in
+// a cursor file. When the spool exceeds its maximum size, the oldest
+// segments are removed, even if their records have not been committed.
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Defaults for the options.
+const (
+	DefaultSegmentSize = 4 << 20
+	DefaultMaxSize     = 256 << 20
+)
+
+const (
+	segmentExt       = ".seg"
+	cursorName       = "cursor"
+	recordHeaderSize = 8  // length and checksum
+	cursorSize       = 16 // segment ID and offset
+)
+
+var (
+	errClosed   = errors.New("spool: closed")
+	errTooLarge = errors.New("spool: record too large")
+	errCorrupt  = errors.New("spool: corrupt record")
+)
+
+// Options control the size of a spool.
+type Options struct {
+	SegmentSize int64 // Size at which a new segment is started, default 4MB
+	MaxSize     int64 // Maximum size of all segments, default 256MB
+}
+
+// Spool is a durable queue of records in a directory. Records are returned
+// in the order they were appended. A record is returned again by Peek until
+// it is committed, including after the spool is closed and reopened, so
+// records are delivered at least once. A Spool is safe for concurrent use,
+// but a directory must only be opened by one Spool at a time.
+//
+// Appended records are written to the operating system, but not synced to
+// disk unless Sync is called, so they survive the process exiting but not
+// necessarily the system crashing. A record that was only partly written
+// is discarded when the spool is opened.
+type Spool struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex // protects the following fields
+	segments []*segment // oldest first; records are appended to the last
+	w        *os.File   // last segment
+	r        *os.File   // first segment
+	roff     int64      // offset of the oldest uncommitted record in r
+	peeked   int64      // size of the record returned by Peek, or zero
+	cursor   *os.File
+	size     int64 // total size of segments
+	evicted  int64 // bytes of records removed by eviction
+	corrupt  int64 // bytes of records skipped because they could not be read
+	closed   bool
+}
+
+type segment struct {
+	id   uint64
+	size int64
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+// Open opens the spool in the directory, creating the directory
+// if it does not exist.
+func Open(dir string, opts Options) (*Spool, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.SegmentSize > opts.MaxSize {
+		opts.SegmentSize = opts.MaxSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, opts: opts}
+	if err := s.open(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open finds the segments and the cursor, and opens the files.
+func (s *Spool) open() error {
+	if err := s.readSegments(); err != nil {
+		return err
+	}
+	var err error
+	s.cursor, err = os.OpenFile(filepath.Join(s.dir, cursorName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	var b [cursorSize]byte
+	if n, _ := s.cursor.ReadAt(b[:], 0); n == cursorSize {
+		id := binary.BigEndian.Uint64(b[:8])
+		off := int64(binary.BigEndian.Uint64(b[8:]))
+		// remove segments that were committed but not yet removed
+		for len(s.segments) > 1 && s.segments[0].id < id {
+			if err := s.removeFirst(); err != nil {
+				return err
+			}
+		}
+		if s.segments[0].id == id && off <= s.segments[0].size {
+			s.roff = off
+		}
+	}
+
+	last := s.segments[len(s.segments)-1]
+	if err := s.repair(last); err != nil {
+		return err
+	}
+	if s.w, err = os.OpenFile(s.segmentPath(last.id), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+		return err
+	}
+	if s.r, err = os.Open(s.segmentPath(s.segments[0].id)); err != nil {
+		return err
+	}
+	return s.writeCursor()
+}
+
+// readSegments lists the segments in the directory, adding
+// an empty segment if there are none.
+func (s *Spool) readSegments() error {
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(s.dir, name))
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, &segment{id: id, size: fi.Size()})
+		s.size += fi.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+	if len(s.segments) == 0 {
+		s.segments = []*segment{{id: 1}}
+	}
+	return nil
+}
+
+// repair truncates a segment after its last complete record, in case
+// the process exited while a record was being written.
+func (s *Spool) repair(seg *segment) error {
+	f, err := os.OpenFile(s.segmentPath(seg.id), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var off int64
+	for off < seg.size {
+		_, n, err := readRecord(f, off, seg.size)
+		if err != nil {
+			break
+		}
+		off += n
+	}
+	if off == seg.size {
+		return nil
+	}
+	if err := f.Truncate(off); err != nil {
+		return err
+	}
+	s.size -= seg.size - off
+	seg.size = off
+	if s.segments[0] == seg && s.roff > off {
+		s.roff = off
+	}
+	return nil
+}
+
+// readRecord reads the record at offset off in f, a segment of the given
+// size. It returns the data and the size of the record including its header.
+func readRecord(f *os.File, off, size int64) ([]byte, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := f.ReadAt(header[:], off); err != nil {
+		return nil, 0, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[:4]))
+	sum := binary.BigEndian.Uint32(header[4:])
+	if off+recordHeaderSize+length > size {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, length)
+	if _, err := f.ReadAt(data, off+recordHeaderSize); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(data) != sum {
+		return nil, 0, errCorrupt
+	}
+	return data, recordHeaderSize + length, nil
+}
+
+// Append adds a record to the spool. If the spool then exceeds its
+// maximum size, the oldest segments are removed.
+func (s *Spool) Append(record []byte) error {
+	size := int64(recordHeaderSize + len(record))
+	if size > s.opts.MaxSize || int64(len(record)) > int64(^uint32(0)) {
+		return errTooLarge
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	last := s.segments[len(s.segments)-1]
+	if last.size > 0 && last.size+size > s.opts.SegmentSize {
+		if err := s.addSegment(); err != nil {
+			return err
+		}
+		last = s.segments[len(s.segments)-1]
+	}
+
+	b := make([]byte, size)
+	binary.BigEndian.PutUint32(b[:4], uint32(len(record)))
+	binary.BigEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(record))
+	copy(b[recordHeaderSize:], record)
+	n, err := s.w.Write(b)
+	last.size += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	for s.size > s.opts.MaxSize && len(s.segments) > 1 {
+		s.evicted += s.segments[0].size - s.roff
+		if err := s.removeFirst(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addSegment starts a new segment for appending records.
+func (s *Spool) addSegment() error {
+	seg := &segment{id: s.segments[len(s.segments)-1].id + 1}
+	w, err := os.OpenFile(s.segmentPath(seg.id), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	s.w.Close()
+	s.w = w
+	s.segments = append(s.segments, seg)
+	return nil
+}
+
+// removeFirst removes the first segment, which must not be the last,
+// and moves the cursor to the start of the next segment.
+func (s *Spool) removeFirst() error {
+	seg := s.segments[0]
+	s.segments = s.segments[1:]
+	s.size -= seg.size
+	s.roff = 0
+	s.peeked = 0
+	if s.r != nil {
+		s.r.Close()
+		s.r = nil
+		var err error
+		if s.r, err = os.Open(s.segmentPath(s.segments[0].id)); err != nil {
+			return err
+		}
+		if err := s.writeCursor(); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(s.segmentPath(seg.id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeCursor records the position of the oldest uncommitted record.
+func (s *Spool) writeCursor() error {
+	var b [cursorSize]byte
+	binary.BigEndian.PutUint64(b[:8], s.segments[0].id)
+	binary.BigEndian.PutUint64(b[8:], uint64(s.roff))
+	_, err := s.cursor.WriteAt(b[:], 0)
+	return err
+}
+
+// Peek returns the oldest uncommitted record, or io.EOF if there is none.
+// Records that fail their checksum or are incomplete are skipped, with the
+// rest of their segment. If that is the segment records are appended to,
+// a new segment is started.
+func (s *Spool) Peek() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errClosed
+	}
+	for {
+		first := s.segments[0]
+		if s.roff < first.size {
+			record, n, err := readRecord(s.r, s.roff, first.size)
+			if err == nil {
+				s.peeked = n
+				return record, nil
+			}
+			if err != errCorrupt && err != io.ErrUnexpectedEOF && err != io.EOF {
+				return nil, err
+			}
+			s.corrupt += first.size - s.roff
+			if len(s.segments) == 1 {
+				if err := s.addSegment(); err != nil {
+					return nil, err
+				}
+			}
+		} else if len(s.segments) == 1 {
+			return nil, io.EOF
+		}
+		if err := s.removeFirst(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Commit removes the record returned by the last call to Peek. It does
+// nothing if the record has already been committed, or was evicted.
+func (s *Spool) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	if s.peeked == 0 {
+		return nil
+	}
+	s.roff += s.peeked
+	s.peeked = 0
+	if s.roff >= s.segments[0].size && len(s.segments) > 1 {
+		return s.removeFirst()
+	}
+	return s.writeCursor()
+}
+
+// Size returns the total size of the segments in bytes,
+// including records that have been committed.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Evicted returns the number of bytes of uncommitted records removed
+// because the spool exceeded its maximum size.
+func (s *Spool) Evicted() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evicted
+}
+
+// Corrupted returns the number of bytes of uncommitted records skipped
+// because they failed their checksum or were incomplete.
+func (s *Spool) Corrupted() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.corrupt
+}
+
+// Sync commits the appended records and the cursor to stable storage.
+func (s *Spool) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	if err := s.w.Sync(); err != nil {
+		return err
+	}
+	return s.cursor.Sync()
+}
+
+// Close closes the spool. Uncommitted records remain in the
+// directory, and are returned when the spool is opened again.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.closeFiles()
+}
+
+func (s *Spool) closeFiles() error {
+	var firstErr error
+	for _, f := range []*os.File{s.w, s.r, s.cursor} {
+		if f != nil {
+			if err := f.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,252 @@
+package spool
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func segmentNames(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range matches {
+		names = append(names, filepath.Base(m))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// drain returns the remaining records, committing each one.
+func drain(t *testing.T, s *Spool) []string {
+	var records []string
+	for {
+		b, err := s.Peek()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(b))
+		if err := s.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAppendPeekCommit(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	s, err := Open(dir, Options{SegmentSize: 30})
+	if !assert.NoError(err) {
+		return
+	}
+	defer s.Close()
+
+	_, err = s.Peek()
+	assert.Equal(io.EOF, err)
+	for i := 0; i < 5; i++ {
+		assert.NoError(s.Append([]byte(fmt.Sprintf("record %d", i))))
+	}
+	// each segment holds one 16 byte record
+	assert.Len(segmentNames(t, dir), 5)
+	assert.Equal(int64(80), s.Size())
+
+	// a record is returned until it is committed
+	b, err := s.Peek()
+	assert.NoError(err)
+	assert.Equal("record 0", string(b))
+	b, _ = s.Peek()
+	assert.Equal("record 0", string(b))
+	assert.NoError(s.Commit())
+	assert.NoError(s.Commit())
+
+	assert.Equal([]string{"record 1", "record 2", "record 3", "record 4"}, drain(t, s))
+	assert.Equal([]string{"0000000000000005.seg"}, segmentNames(t, dir))
+	assert.NoError(s.Append([]byte("record 5")))
+	assert.Equal([]string{"record 5"}, drain(t, s))
+	assert.NoError(s.Close())
+
+	_, err = s.Peek()
+	assert.Equal(errClosed, err)
+	assert.Equal(errClosed, s.Append([]byte("closed")))
+}
+
+func TestReopen(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	s, err := Open(dir, Options{SegmentSize: 40})
+	if !assert.NoError(err) {
+		return
+	}
+	for i := 0; i < 6; i++ {
+		assert.NoError(s.Append([]byte(fmt.Sprintf("record %d", i))))
+	}
+	for i := 0; i < 3; i++ {
+		s.Peek()
+		s.Commit()
+	}
+	assert.NoError(s.Sync())
+	assert.NoError(s.Close())
+
+	s, err = Open(dir, Options{SegmentSize: 40})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(s.Append([]byte("record 6")))
+	assert.Equal([]string{"record 3", "record 4", "record 5", "record 6"}, drain(t, s))
+	assert.NoError(s.Close())
+
+	s, err = Open(dir, Options{})
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = s.Peek()
+	assert.Equal(io.EOF, err)
+	assert.NoError(s.Close())
+}
+
+func TestRepair(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	s, err := Open(dir, Options{})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(s.Append([]byte("complete")))
+	assert.NoError(s.Close())
+
+	// a record that was only partly written
+	path := filepath.Join(dir, segmentNames(t, dir)[0])
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	f.Write([]byte{0, 0, 0, 10, 1, 2, 3, 4, 'p', 'a', 'r'})
+	f.Close()
+
+	s, err = Open(dir, Options{})
+	if !assert.NoError(err) {
+		return
+	}
+	defer s.Close()
+	assert.Equal(int64(16), s.Size())
+	assert.NoError(s.Append([]byte("after")))
+	assert.Equal([]string{"complete", "after"}, drain(t, s))
+}
+
+func TestCorruptSegment(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	s, err := Open(dir, Options{SegmentSize: 40})
+	if !assert.NoError(err) {
+		return
+	}
+	for i := 0; i < 4; i++ {
+		assert.NoError(s.Append([]byte(fmt.Sprintf("record %d", i))))
+	}
+	assert.NoError(s.Close())
+
+	// damage the data of the first record
+	path := filepath.Join(dir, segmentNames(t, dir)[0])
+	f, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	f.WriteAt([]byte("X"), recordHeaderSize)
+	f.Close()
+
+	s, err = Open(dir, Options{SegmentSize: 40})
+	if !assert.NoError(err) {
+		return
+	}
+	defer s.Close()
+	// the rest of the damaged segment is skipped
+	assert.Equal([]string{"record 2", "record 3"}, drain(t, s))
+	assert.Equal(int64(32), s.Corrupted())
+}
+
+func TestCorruptLastSegment(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	s, err := Open(dir, Options{})
+	if !assert.NoError(err) {
+		return
+	}
+	defer s.Close()
+	for i := 0; i < 4; i++ {
+		assert.NoError(s.Append([]byte(fmt.Sprintf("record %d", i))))
+	}
+
+	// damage the data of the second record while the spool is open
+	path := filepath.Join(dir, segmentNames(t, dir)[0])
+	f, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	f.WriteAt([]byte("X"), 16+recordHeaderSize)
+	f.Close()
+
+	// the rest of the segment is skipped, and records
+	// are appended to a new segment
+	assert.Equal([]string{"record 0"}, drain(t, s))
+	assert.Equal(int64(48), s.Corrupted())
+	assert.Equal([]string{"0000000000000002.seg"}, segmentNames(t, dir))
+	assert.NoError(s.Append([]byte("after")))
+	assert.Equal([]string{"after"}, drain(t, s))
+}
+
+func TestEviction(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	s, err := Open(dir, Options{SegmentSize: 32, MaxSize: 64})
+	if !assert.NoError(err) {
+		return
+	}
+	defer s.Close()
+	for i := 0; i < 10; i++ {
+		assert.NoError(s.Append([]byte(fmt.Sprintf("record %d", i))))
+	}
+	assert.Equal(int64(64), s.Size())
+	assert.Equal(int64(96), s.Evicted())
+	assert.Equal([]string{"record 6", "record 7", "record 8", "record 9"}, drain(t, s))
+
+	assert.Equal(errTooLarge, s.Append(make([]byte, 57)))
+}
+
+func TestEvictPeeked(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	s, err := Open(dir, Options{SegmentSize: 16, MaxSize: 32})
+	if !assert.NoError(err) {
+		return
+	}
+	defer s.Close()
+	assert.NoError(s.Append([]byte("record 0")))
+	b, _ := s.Peek()
+	assert.Equal("record 0", string(b))
+	assert.NoError(s.Append([]byte("record 1")))
+	assert.NoError(s.Append([]byte("record 2")))
+	// the peeked record was evicted, so commit does not remove record 1
+	assert.NoError(s.Commit())
+	assert.Equal(int64(16), s.Evicted())
+	assert.Equal([]string{"record 1", "record 2"}, drain(t, s))
+}
@@ -0,0 +1,562 @@
+// Package syslog provides a slog handler that sends messages to a syslog
+// server, using the RFC 5424 or RFC 3164 (BSD) message format.
+//
+// Unlike the standard library syslog package, properties and context
+// values are sent as RFC 5424 structured data, so that they can be
+// queried by the receiving system.
+//
+//	h, err := syslog.Dial(syslog.Config{
+//		Network:  "tcp",
+//		Addr:     "logs.example.com:601",
+//		Facility: syslog.Local0,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer h.Close()
+//	slog.AddHandler(h)
+//
+// The package registers the "syslog" handler type for use in a slog.Config,
+// with a Config in JSON format as its parameters.
+package syslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/handlerfmt"
+	"github.com/spkg/slog/internal/jsonconfig"
+	"github.com/spkg/slog/internal/redial"
+	"github.com/spkg/slog/logfmt"
+)
+
+// defaultSDID is the structured data ID used if none is configured. The
+// private enterprise number 32473 is reserved for use in documentation.
+const defaultSDID = "slog@32473"
+
+// DefaultTimeout is the default timeout of connecting and of each write.
+const DefaultTimeout = 5 * time.Second
+
+// localAddrs are the paths of the local syslog socket on common systems.
+var localAddrs = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var (
+	errUnknownFacility = errors.New("syslog: unknown facility")
+	errUnknownFormat   = errors.New("syslog: unknown format")
+	errUnknownNetwork  = errors.New("syslog: unknown network")
+	errNoLocalSyslog   = errors.New("syslog: no local syslog socket")
+	errNotConnected    = errors.New("syslog: not connected")
+)
+
+// Format is the syslog message format.
+type Format int
+
+// Message formats.
+const (
+	RFC5424 Format = iota // Default format, with structured data
+	RFC3164               // BSD syslog format, properties are appended to the message text
+)
+
+var formatNames = map[Format]string{
+	RFC5424: "rfc5424",
+	RFC3164: "rfc3164",
+}
+
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return "Format(" + strconv.Itoa(int(f)) + ")"
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (f Format) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (f *Format) UnmarshalText(text []byte) error {
+	for format, name := range formatNames {
+		if strings.EqualFold(string(text), name) {
+			*f = format
+			return nil
+		}
+	}
+	return errUnknownFormat
+}
+
+// Facility is the syslog facility, which identifies the type
+// of program sending the message.
+type Facility int
+
+// Facilities. The kernel facility cannot be used, and the zero value
+// of Facility is User.
+const (
+	User Facility = iota + 1
+	Mail
+	Daemon
+	Auth
+	Syslog
+	LPR
+	News
+	UUCP
+	Cron
+	AuthPriv
+	FTP
+	Local0 Facility = iota + 5
+	Local1
+	Local2
+	Local3
+	Local4
+	Local5
+	Local6
+	Local7
+)
+
+var facilityNames = map[Facility]string{
+	User:     "user",
+	Mail:     "mail",
+	Daemon:   "daemon",
+	Auth:     "auth",
+	Syslog:   "syslog",
+	LPR:      "lpr",
+	News:     "news",
+	UUCP:     "uucp",
+	Cron:     "cron",
+	AuthPriv: "authpriv",
+	FTP:      "ftp",
+	Local0:   "local0",
+	Local1:   "local1",
+	Local2:   "local2",
+	Local3:   "local3",
+	Local4:   "local4",
+	Local5:   "local5",
+	Local6:   "local6",
+	Local7:   "local7",
+}
+
+func (f Facility) String() string {
+	if f == 0 {
+		f = User
+	}
+	if name, ok := facilityNames[f]; ok {
+		return name
+	}
+	return "Facility(" + strconv.Itoa(int(f)) + ")"
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (f Facility) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (f *Facility) UnmarshalText(text []byte) error {
+	for facility, name := range facilityNames {
+		if strings.EqualFold(string(text), name) {
+			*f = facility
+			return nil
+		}
+	}
+	return errUnknownFacility
+}
+
+// code returns the facility code used in the message priority.
+func (f Facility) code() int {
+	if f == 0 {
+		return int(User)
+	}
+	return int(f)
+}
+
+// Config describes the syslog server and the messages sent to it.
+type Config struct {
+	Network  string   `json:"network,omitempty"`  // "udp", "tcp", "unix" or "unixgram"; empty for the local syslog
+	Addr     string   `json:"addr,omitempty"`     // Server address or socket path
+	Format   Format   `json:"format,omitempty"`   // Message format, default RFC5424
+	Facility Facility `json:"facility,omitempty"` // Facility, default User
+	AppName  string   `json:"app_name,omitempty"` // Application name, default is the program name
+	Hostname string   `json:"hostname,omitempty"` // Host name, default is the system host name
+	SDID     string   `json:"sd_id,omitempty"`    // Structured data ID for RFC 5424, default "slog@32473"
+
+	// Timeout of connecting and of each write, default DefaultTimeout.
+	// In the JSON format it is a string such as "5s".
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface,
+// parsing the timeout with time.ParseDuration.
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type config Config
+	return jsonconfig.Unmarshal(b, (*config)(c), "timeout")
+}
+
+// Handler is a slog.Handler that sends messages to a syslog server.
+//
+// Messages sent over a stream connection (TCP or a Unix stream socket) are
+// framed using octet counting as described in RFC 6587. Messages sent over
+// UDP or a Unix datagram socket are sent one message per datagram.
+//
+// If sending a message fails, the handler reconnects and tries again once.
+// If that fails too, the message is dropped. If a write times out, the
+// message is dropped without trying again, and the handler reconnects
+// when the next message is sent, so that a server that is not reading
+// holds up the logger for at most the timeout. After a failed attempt to
+// reconnect, messages are dropped without trying to connect for one second,
+// doubling after each consecutive failure up to a minute, so that a server
+// that is down does not hold up the logger for every message. A Handler is
+// safe for concurrent use.
+type Handler struct {
+	config Config
+	pid    string
+
+	mu      sync.Mutex // protects the following fields
+	conn    net.Conn   // nil after the connection fails
+	network string     // network of conn, resolved for the local syslog
+	backoff redial.Backoff
+	dropped int64
+	closed  bool
+}
+
+func init() {
+	slog.RegisterHandlerFactory("syslog", func(params json.RawMessage) (slog.Handler, error) {
+		var c Config
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &c); err != nil {
+				return nil, err
+			}
+		}
+		return Dial(c)
+	})
+}
+
+// Dial connects to the syslog server described by the configuration. If the
+// network is empty, Dial connects to the local syslog socket.
+func Dial(c Config) (*Handler, error) {
+	switch c.Network {
+	case "", "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unix", "unixgram":
+	default:
+		return nil, errUnknownNetwork
+	}
+	if c.AppName == "" {
+		c.AppName = filepath.Base(os.Args[0])
+	}
+	if c.Hostname == "" {
+		c.Hostname, _ = os.Hostname()
+	}
+	if c.SDID == "" {
+		c.SDID = defaultSDID
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	h := &Handler{
+		config: c,
+		pid:    strconv.Itoa(os.Getpid()),
+	}
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// connect connects to the syslog server.
+func (h *Handler) connect() error {
+	if h.config.Network != "" {
+		conn, err := net.DialTimeout(h.config.Network, h.config.Addr, h.config.Timeout)
+		if err != nil {
+			return err
+		}
+		h.conn, h.network = conn, h.config.Network
+		return nil
+	}
+
+	addrs := localAddrs
+	if h.config.Addr != "" {
+		addrs = []string{h.config.Addr}
+	}
+	for _, addr := range addrs {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.DialTimeout(network, addr, h.config.Timeout); err == nil {
+				h.conn, h.network = conn, network
+				return nil
+			}
+		}
+	}
+	return errNoLocalSyslog
+}
+
+// Handle implements the slog.Handler interface.
+func (h *Handler) Handle(msgs []*slog.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	var buf bytes.Buffer
+	for _, m := range msgs {
+		if err := h.send(&buf, h.encode(m)); err != nil {
+			h.dropped++
+		}
+	}
+}
+
+// Dropped returns the number of messages dropped because
+// they could not be sent.
+func (h *Handler) Dropped() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// send frames and sends an encoded message, reconnecting if needed.
+func (h *Handler) send(buf *bytes.Buffer, msg []byte) error {
+	if h.conn == nil {
+		if err := h.reconnect(); err != nil {
+			return err
+		}
+	}
+	buf.Reset()
+	h.frame(buf, msg)
+	err := h.write(buf.Bytes())
+	if err == nil {
+		return nil
+	}
+	// part of the message may have been written to a stream,
+	// so the connection cannot be used for the next message
+	h.conn.Close()
+	h.conn = nil
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return err
+	}
+	// reconnect and try once more
+	if err := h.reconnect(); err != nil {
+		return err
+	}
+	buf.Reset()
+	h.frame(buf, msg)
+	if err := h.write(buf.Bytes()); err != nil {
+		h.conn.Close()
+		h.conn = nil
+		return err
+	}
+	return nil
+}
+
+// reconnect connects to the syslog server, unless an attempt
+// failed recently, in which case it returns errNotConnected.
+func (h *Handler) reconnect() error {
+	now := time.Now()
+	if !h.backoff.Ready(now) {
+		return errNotConnected
+	}
+	if err := h.connect(); err != nil {
+		h.backoff.Fail(now)
+		return err
+	}
+	h.backoff.Reset()
+	return nil
+}
+
+func (h *Handler) write(b []byte) error {
+	if h.conn == nil {
+		return errNotConnected
+	}
+	h.conn.SetWriteDeadline(time.Now().Add(h.config.Timeout))
+	_, err := h.conn.Write(b)
+	return err
+}
+
+// Close closes the connection to the syslog server.
+func (h *Handler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	if h.conn == nil {
+		return nil
+	}
+	return h.conn.Close()
+}
+
+// frame adds the message to buf, with octet counting for stream connections.
+func (h *Handler) frame(buf *bytes.Buffer, msg []byte) {
+	switch h.network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		buf.WriteString(strconv.Itoa(len(msg)))
+		buf.WriteByte(' ')
+	}
+	buf.Write(msg)
+}
+
+// encode returns the message in the configured format.
+func (h *Handler) encode(m *slog.Message) []byte {
+	if h.config.Format == RFC3164 {
+		return h.encode3164(m)
+	}
+	return h.encode5424(m)
+}
+
+// priority returns the PRI part of the message.
+func (h *Handler) priority(level slog.Level) string {
+	return "<" + strconv.Itoa(h.config.Facility.code()*8+handlerfmt.Severity(level)) + ">"
+}
+
+// encode5424 formats the message as described in RFC 5424:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+//
+// The message code is used as the MSGID.
+func (h *Handler) encode5424(m *slog.Message) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(h.priority(m.Level))
+	buf.WriteString("1 ")
+	buf.WriteString(m.Timestamp.Format("2006-01-02T15:04:05.000000Z07:00"))
+	buf.WriteByte(' ')
+	buf.WriteString(header(h.config.Hostname, 255))
+	buf.WriteByte(' ')
+	buf.WriteString(header(h.config.AppName, 48))
+	buf.WriteByte(' ')
+	buf.WriteString(header(h.pid, 128))
+	buf.WriteByte(' ')
+	buf.WriteString(header(m.Code(), 32))
+	buf.WriteByte(' ')
+	h.writeStructuredData(&buf, m)
+	if m.Text != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(m.Text)
+	}
+	return buf.Bytes()
+}
+
+// writeStructuredData writes the properties and context of the message,
+// and its error, logger name and status, as a structured data element.
+func (h *Handler) writeStructuredData(buf *bytes.Buffer, m *slog.Message) {
+	start := buf.Len()
+	param := func(key string, value interface{}) {
+		if buf.Len() == start {
+			buf.WriteByte('[')
+			buf.WriteString(h.config.SDID)
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(paramName(key))
+		buf.WriteString(`="`)
+		writeParamValue(buf, handlerfmt.Value(value))
+		buf.WriteByte('"')
+	}
+	if m.Err != nil {
+		param("error", m.Err.Error())
+	}
+	if m.Logger != "" {
+		param("logger", m.Logger)
+	}
+	for _, p := range m.Properties {
+		param(p.Key, p.Value)
+	}
+	for _, p := range m.Context {
+		param(p.Key, p.Value)
+	}
+	if m.Status() != 0 {
+		param("status", m.Status())
+	}
+	if buf.Len() == start {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteByte(']')
+	}
+}
+
+// encode3164 formats the message as described in RFC 3164:
+//
+//	<PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+//
+// Properties and context are appended to the message text in logfmt format.
+func (h *Handler) encode3164(m *slog.Message) []byte {
+	var lf logfmt.Buffer
+	defer lf.Reset()
+	if m.Logger != "" {
+		lf.WriteProperty("logger", m.Logger)
+	}
+	if m.Err != nil {
+		lf.WriteProperty("error", m.Err.Error())
+	}
+	for _, p := range m.Properties {
+		lf.WriteProperty(p.Key, p.Value)
+	}
+	for _, p := range m.Context {
+		lf.WriteProperty(p.Key, p.Value)
+	}
+	if m.Code() != "" {
+		lf.WriteProperty("code", m.Code())
+	}
+	if m.Status() != 0 {
+		lf.WriteProperty("status", m.Status())
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(h.priority(m.Level))
+	buf.WriteString(m.Timestamp.Local().Format(time.Stamp))
+	buf.WriteByte(' ')
+	buf.WriteString(header(h.config.Hostname, 255))
+	buf.WriteByte(' ')
+	buf.WriteString(header(h.config.AppName, 32))
+	buf.WriteString("[" + h.pid + "]: ")
+	buf.WriteString(m.Text)
+	if lf.Len() > 0 {
+		buf.WriteByte(' ')
+		lf.WriteTo(&buf)
+	}
+	return buf.Bytes()
+}
+
+// header returns a header field, which is printable ASCII without
+// spaces, or "-" if the value is empty.
+func header(value string, maxLen int) string {
+	if value == "" {
+		return "-"
+	}
+	b := []byte(value)
+	for i, c := range b {
+		if c <= ' ' || c > '~' {
+			b[i] = '_'
+		}
+	}
+	if len(b) > maxLen {
+		b = b[:maxLen]
+	}
+	return string(b)
+}
+
+// paramName returns the key as a structured data parameter name, which
+// is at most 32 printable ASCII characters, excluding '=', ' ', ']' and '"'.
+func paramName(key string) string {
+	b := []byte(header(key, 32))
+	for i, c := range b {
+		if c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// writeParamValue writes a structured data parameter value,
+// escaping '"', '\' and ']' with a backslash.
+func writeParamValue(buf *bytes.Buffer, value string) {
+	for _, c := range value {
+		if c == '"' || c == '\\' || c == ']' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(c)
+	}
+}
@@ -0,0 +1,235 @@
+package syslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/net/context"
+
+	"github.com/spkg/slog"
+	"github.com/spkg/slog/internal/handlertest"
+)
+
+func testMessage() *slog.Message {
+	m := &slog.Message{
+		Timestamp:  handlertest.Time,
+		Level:      slog.LevelWarning,
+		Text:       "disk almost full",
+		Err:        errors.New("quota exceeded"),
+		Logger:     "storage",
+		Properties: []slog.Property{{Key: "path", Value: `C:\data [1]`}, {Key: "free space", Value: 12.5}},
+		Context:    []slog.Property{{Key: "request", Value: 42}},
+	}
+	m.SetCode("DISK")
+	return m
+}
+
+func TestEncode5424(t *testing.T) {
+	assert := assert.New(t)
+	h := &Handler{
+		config: Config{Facility: Local0, AppName: "app", Hostname: "host", SDID: defaultSDID},
+		pid:    "123",
+	}
+	expected := `<132>1 2020-01-02T03:04:05.678901Z host app 123 DISK [slog@32473 error="quota exceeded" ` +
+		`logger="storage" path="C:\\data [1\]" free_space="12.5" request="42"] disk almost full`
+	assert.Equal(expected, string(h.encode(testMessage())))
+
+	m := &slog.Message{Timestamp: handlertest.Time, Level: slog.LevelInfo}
+	assert.Equal("<134>1 2020-01-02T03:04:05.678901Z host app 123 - -", string(h.encode(m)))
+}
+
+func TestEncode3164(t *testing.T) {
+	assert := assert.New(t)
+	h := &Handler{
+		config: Config{Format: RFC3164, AppName: "app", Hostname: "host"},
+		pid:    "123",
+	}
+	expected := "<12>" + handlertest.Time.Local().Format(time.Stamp) + ` host app[123]: disk almost full ` +
+		`logger=storage error="quota exceeded" path="C:\\data [1]" free space=12.5 request=42 code=DISK`
+	assert.Equal(expected, string(h.encode(testMessage())))
+}
+
+func TestFacilityAndFormatText(t *testing.T) {
+	assert := assert.New(t)
+	var f Facility
+	assert.Equal("user", f.String())
+	assert.NoError(f.UnmarshalText([]byte("LOCAL7")))
+	assert.Equal(Local7, f)
+	assert.Equal(23, f.code())
+	assert.Error(f.UnmarshalText([]byte("kern")))
+
+	var format Format
+	assert.NoError(format.UnmarshalText([]byte("rfc3164")))
+	assert.Equal(RFC3164, format)
+	assert.Error(format.UnmarshalText([]byte("rfc1")))
+}
+
+func TestUDP(t *testing.T) {
+	assert := assert.New(t)
+	conn := handlertest.ListenUDP(t)
+	h, err := Dial(Config{Network: "udp", Addr: conn.LocalAddr().String(), AppName: "app"})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	h.Handle([]*slog.Message{testMessage(), testMessage()})
+
+	for i := 0; i < 2; i++ {
+		msg := string(handlertest.ReadPacket(t, conn))
+		assert.True(strings.HasPrefix(msg, "<12>1 2020-01-02T03:04:05.678901Z "))
+		assert.True(strings.HasSuffix(msg, "] disk almost full"))
+	}
+}
+
+// readFramed reads a message framed with octet counting: MSG-LEN SP SYSLOG-MSG
+func readFramed(r *bufio.Reader) (string, error) {
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(prefix))
+	msg := make([]byte, n)
+	_, err = io.ReadFull(r, msg)
+	return string(msg), err
+}
+
+func TestTCP(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewTCPServer(t, readFramed)
+
+	l := slog.New()
+	l.SetOutput(ioutil.Discard)
+	h, err := Dial(Config{Network: "tcp", Addr: s.Addr})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	l.AddHandler(h)
+	l.Info(context.Background(), "first message")
+	l.Error(context.Background(), "second message", slog.WithValue("a", "b"))
+
+	for _, suffix := range []string{"- first message", `[slog@32473 a="b"] second message`} {
+		msg := s.Next()
+		assert.True(strings.HasSuffix(msg, suffix), msg)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	assert := assert.New(t)
+	addr := handlertest.ListenStalled(t)
+	var c Config
+	err := json.Unmarshal([]byte(`{"network": "tcp", "addr": "`+addr+`", "timeout": "50ms"}`), &c)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(50*time.Millisecond, c.Timeout)
+	h, err := Dial(c)
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+
+	// once the socket buffers are full, writes time out and
+	// the messages are dropped
+	text := strings.Repeat("x", 1<<20)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 32; i++ {
+			h.Handle([]*slog.Message{{Timestamp: handlertest.Time, Level: slog.LevelInfo, Text: text}})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("write did not time out")
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	assert := assert.New(t)
+	s := handlertest.NewTCPServer(t, readFramed)
+	h, err := Dial(Config{Network: "tcp", Addr: s.Addr})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+
+	// the server goes away
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	ln.Close()
+	h.conn.Close()
+	h.conn = nil
+	h.config.Addr = ln.Addr().String()
+	assert.Equal(errNotConnected, h.write(nil))
+	h.Handle(handlertest.Messages("refused"))
+	assert.Equal(int64(1), h.Dropped())
+
+	// messages are dropped without connecting until the backoff
+	// has passed, even though the server is back
+	s = handlertest.NewTCPServer(t, readFramed)
+	h.config.Addr = s.Addr
+	h.Handle(handlertest.Messages("not connected"))
+	assert.Equal(int64(2), h.Dropped())
+	assert.Nil(h.conn)
+
+	h.backoff.Reset()
+	h.Handle(handlertest.Messages("reconnected"))
+	assert.True(strings.HasSuffix(s.Next(), "- reconnected"))
+	assert.Equal(int64(2), h.Dropped())
+}
+
+func TestLocalUnixgram(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "syslog")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skip("unixgram not supported:", err)
+	}
+	defer conn.Close()
+
+	h, err := Dial(Config{Addr: path, Format: RFC3164, AppName: "app", Hostname: "host"})
+	if !assert.NoError(err) {
+		return
+	}
+	defer h.Close()
+	assert.Equal("unixgram", h.network)
+	h.Handle([]*slog.Message{{Timestamp: handlertest.Time, Level: slog.LevelDebug, Text: "hello"}})
+
+	assert.Equal(fmt.Sprintf("<15>%s host app[%d]: hello", handlertest.Time.Local().Format(time.Stamp), os.Getpid()),
+		string(handlertest.ReadPacket(t, conn)))
+}
+
+func TestConfigFactory(t *testing.T) {
+	assert := assert.New(t)
+	conn := handlertest.ListenUDP(t)
+	l := handlertest.ConfigLogger(t, "syslog", `{"network": "udp", "addr": "`+conn.LocalAddr().String()+`", "facility": "local1", "app_name": "cfg"}`)
+	l.Info(context.Background(), "configured")
+	msg := string(handlertest.ReadPacket(t, conn))
+	assert.True(strings.HasPrefix(msg, "<142>1 "))
+	assert.Contains(msg, " cfg ")
+
+	_, err := Dial(Config{Network: "ipx"})
+	assert.Error(err)
+}